@@ -0,0 +1,45 @@
+package cmd
+
+import "errors"
+
+// ErrAlreadyStarted is returned when a command is modified in a way that
+// can't take effect because it has already been started.
+var ErrAlreadyStarted = errors.New("command already started")
+
+// AppendArgs appends "args" to the command's arguments and returns the
+// command, so that calls can be chained.
+//
+// If the command has already been started, then its arguments are left
+// alone and subsequent calls to Start return ErrAlreadyStarted, until Reset
+// is called. Commands made from it by Clone aren't affected.
+func (cmd *Command) AppendArgs(args ...string) *Command {
+	if cmd.Process != nil {
+		cmd.configErr = ErrAlreadyStarted
+		return cmd
+	}
+	cmd.Args = append(cmd.Args, args...)
+	return cmd
+}
+
+// PrependArgs inserts "args" before the command's existing arguments, but
+// after the name of the program (Args[0]). It returns the command, so that
+// calls can be chained.
+//
+// If the command has already been started, then its arguments are left
+// alone and subsequent calls to Start return ErrAlreadyStarted, until Reset
+// is called. Commands made from it by Clone aren't affected.
+func (cmd *Command) PrependArgs(args ...string) *Command {
+	if cmd.Process != nil {
+		cmd.configErr = ErrAlreadyStarted
+		return cmd
+	}
+	if len(cmd.Args) == 0 {
+		cmd.Args = append(cmd.Args, args...)
+		return cmd
+	}
+	newArgs := make([]string, 0, len(cmd.Args)+len(args))
+	newArgs = append(newArgs, cmd.Args[0])
+	newArgs = append(newArgs, args...)
+	cmd.Args = append(newArgs, cmd.Args[1:]...)
+	return cmd
+}
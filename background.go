@@ -0,0 +1,14 @@
+package cmd
+
+// Background lowers the scheduling priority of the command, for batch jobs
+// that shouldn't compete with interactive work. When the command starts, its
+// CPU niceness is set to 19 (the lowest priority) and its I/O scheduling
+// class is set to idle, so that it only uses the disk when nothing else
+// does. It must be called before the command is started.
+//
+// Background only has an effect on Linux. On other platforms, it does
+// nothing.
+func (cmd *Command) Background() *Command {
+	cmd.background = true
+	return cmd
+}
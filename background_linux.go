@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// deprioritize sets the niceness of the started command to 19 and its I/O
+// scheduling class to idle. A process that has already exited is left alone.
+func (cmd *Command) deprioritize() error {
+	pid := cmd.Process.Pid
+	err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, 19)
+	if err == nil {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET,
+			ioprioWhoProcess, uintptr(pid),
+			ioprioClassIdle<<ioprioClassShift)
+		if errno != 0 {
+			err = errno
+		}
+	}
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
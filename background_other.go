@@ -0,0 +1,7 @@
+//go:build !linux
+
+package cmd
+
+func (cmd *Command) deprioritize() error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// BenchmarkResult summarizes the running times of a command that was run
+// repeatedly by Benchmark.
+type BenchmarkResult struct {
+	// N is the number of times the command was run.
+	N int
+	// Failures is the number of runs that returned an error.
+	Failures int
+	// Durations is the running time of each run, in the order they were run.
+	Durations []time.Duration
+
+	Min, Mean, P95, Max time.Duration
+}
+
+// Benchmark runs the command returned by "factory" "n" times, one after the
+// other, and returns a summary of their running times. Failed runs are
+// counted, but are otherwise timed like any other run. "factory" is called
+// for every run, since a Commander can't generally be run more than once.
+func Benchmark(n int, factory func() Commander) *BenchmarkResult {
+	r := &BenchmarkResult{N: n}
+	for i := 0; i < n; i++ {
+		c := factory()
+		start := time.Now()
+		if err := c.Run(); err != nil {
+			r.Failures++
+		}
+		r.Durations = append(r.Durations, time.Since(start))
+	}
+	if n < 1 {
+		return r
+	}
+
+	sorted := slices.Clone(r.Durations)
+	slices.Sort(sorted)
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	r.Min = sorted[0]
+	r.Max = sorted[len(sorted)-1]
+	r.Mean = total / time.Duration(len(sorted))
+	r.P95 = sorted[(len(sorted)*95+99)/100-1]
+	return r
+}
+
+// String returns a one line summary of the benchmark, e.g.,
+//
+//	N=100 min=12ms mean=45ms p95=120ms max=350ms failures=2
+func (r *BenchmarkResult) String() string {
+	return fmt.Sprintf("N=%d min=%s mean=%s p95=%s max=%s failures=%d",
+		r.N, humanDuration(r.Min), humanDuration(r.Mean),
+		humanDuration(r.P95), humanDuration(r.Max), r.Failures)
+}
+
+// WriteTo writes the summary returned by String to "w", followed by a new
+// line.
+func (r *BenchmarkResult) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, r.String()+"\n")
+	return int64(n), err
+}
+
+// CSV returns the summary of the benchmark as CSV with a header row. All
+// durations are in nanoseconds.
+func (r *BenchmarkResult) CSV() string {
+	return fmt.Sprintf("n,min_ns,mean_ns,p95_ns,max_ns,failures\n"+
+		"%d,%d,%d,%d,%d,%d\n",
+		r.N, r.Min, r.Mean, r.P95, r.Max, r.Failures)
+}
+
+// humanDuration rounds "d" to a precision that is appropriate for its
+// magnitude, so that it is easy to read.
+func humanDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Millisecond / 10)
+	case d >= time.Microsecond:
+		return d.Round(time.Microsecond / 10)
+	}
+	return d
+}
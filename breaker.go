@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrFailureRate is wrapped, along with ErrSkipped, by the error of every
+// command that RunManyFailureRate doesn't start.
+var ErrFailureRate = errors.New("failure rate exceeded")
+
+// RunManyFailureRate is like RunMany, except no more commands are started
+// once the ratio of failures among the last "window" commands to finish
+// exceeds "maxRatio". The ratio isn't checked until at least "window"
+// commands have finished. Commands that are already running are left to
+// finish.
+//
+// The error of every command that isn't started wraps ErrSkipped and
+// ErrFailureRate.
+func (cmds Commands) RunManyFailureRate(workers int, window int,
+	maxRatio float64) []error {
+
+	rate := &failureRate{window: make([]bool, max(window, 1)), max: maxRatio}
+	wrapped := make(Commands, len(cmds))
+	for i, c := range cmds {
+		wrapped[i] = commanderFunc(func() error {
+			if rate.exceeded() {
+				return fmt.Errorf("%w: %w", ErrSkipped, ErrFailureRate)
+			}
+			err := runContext(context.Background(), c)
+			rate.record(err != nil)
+			return err
+		})
+	}
+	return wrapped.RunMany(workers)
+}
+
+// failureRate tracks the ratio of failures over a sliding window of the most
+// recent outcomes.
+type failureRate struct {
+	mu       sync.Mutex
+	window   []bool
+	next     int
+	count    int
+	failures int
+	max      float64
+	tripped  bool
+}
+
+// record adds an outcome to the window, and trips the breaker if the ratio
+// of failures is too high.
+func (r *failureRate) record(failed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.count == len(r.window) && r.window[r.next] {
+		r.failures--
+	}
+	r.window[r.next] = failed
+	r.next = (r.next + 1) % len(r.window)
+	r.count = min(r.count+1, len(r.window))
+	if failed {
+		r.failures++
+	}
+	if r.count == len(r.window) &&
+		float64(r.failures)/float64(len(r.window)) > r.max {
+		r.tripped = true
+	}
+}
+
+func (r *failureRate) exceeded() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.tripped
+}
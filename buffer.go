@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"sync"
+)
+
+// SafeBuffer is a bytes.Buffer that is safe for concurrent use. It is used
+// for a Command's stdin, stdout and stderr buffers, so that they may be read
+// while the command is running.
+//
+// The zero value is an empty buffer ready to use.
+type SafeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// Read reads from the buffer, as in (*bytes.Buffer).Read.
+func (b *SafeBuffer) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Read(p)
+}
+
+// Write appends to the buffer, as in (*bytes.Buffer).Write.
+func (b *SafeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+// WriteString appends to the buffer, as in (*bytes.Buffer).WriteString.
+func (b *SafeBuffer) WriteString(s string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.WriteString(s)
+}
+
+// Len returns the number of unread bytes in the buffer.
+func (b *SafeBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Len()
+}
+
+// Bytes returns a copy of the unread portion of the buffer. Unlike
+// (*bytes.Buffer).Bytes, the slice returned is never modified by subsequent
+// writes to the buffer.
+func (b *SafeBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return bytes.Clone(b.buf.Bytes())
+}
+
+// bytesFrom is like Bytes, except only the unread bytes after the first "off"
+// are returned.
+func (b *SafeBuffer) bytesFrom(off int) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if off >= b.buf.Len() {
+		return nil
+	}
+	return bytes.Clone(b.buf.Bytes()[off:])
+}
+
+// String returns the unread portion of the buffer as a string.
+func (b *SafeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// Reset empties the buffer.
+func (b *SafeBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf.Reset()
+}
+
+// maxPooledBuffer is the largest capacity of a buffer that is put back in
+// bufferPool. Larger buffers are left to the garbage collector, so that a
+// single command with a lot of output doesn't keep its memory alive.
+const maxPooledBuffer = 64 << 10
+
+// bufferPool holds the buffers released by ReleaseBuffers, for reuse by New.
+var bufferPool = sync.Pool{
+	New: func() any { return new(SafeBuffer) },
+}
+
+// newBuffer returns an empty buffer, reusing a released one if possible.
+func newBuffer() *SafeBuffer {
+	return bufferPool.Get().(*SafeBuffer)
+}
+
+// releaseBuffer puts "b" back in bufferPool, if it isn't too large.
+func releaseBuffer(b *SafeBuffer) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.buf.Reset()
+	size := b.buf.Cap()
+	b.mu.Unlock()
+	if size <= maxPooledBuffer {
+		bufferPool.Put(b)
+	}
+}
+
+// ReleaseBuffers returns the command's stdin, stdout and stderr buffers to a
+// pool shared by every command, so that they can be reused by commands
+// created later with New. This reduces allocations when running a large
+// number of commands. Calling it is optional: buffers that aren't released
+// are garbage collected as usual.
+//
+// ReleaseBuffers must only be called once the command has been waited on,
+// and once the caller is done reading its output. Afterwards, BufStdin,
+// BufStdout and BufStderr are replaced by new empty buffers, which the
+// command's streams that were attached to the old ones are attached to
+// instead, so that methods reading the buffers (e.g., SafeOutput) return
+// nothing rather than panic. The released buffers must not be used,
+// including through references to them obtained earlier, since they may be
+// in use by another command. The command itself must not be run again,
+// reset or cloned.
+func (cmd *Command) ReleaseBuffers() {
+	bufs := []*SafeBuffer{cmd.BufStdin, cmd.BufStdout, cmd.BufStderr}
+	stdin, stdout, stderr := new(SafeBuffer), new(SafeBuffer), new(SafeBuffer)
+	if cmd.Stdin == cmd.BufStdin {
+		cmd.Stdin = stdin
+	}
+	if cmd.Stdout == cmd.BufStdout {
+		cmd.Stdout = stdout
+	}
+	if cmd.Stderr == cmd.BufStderr {
+		cmd.Stderr = stderr
+	}
+	cmd.BufStdin, cmd.BufStdout, cmd.BufStderr = stdin, stdout, stderr
+	for _, b := range bufs {
+		releaseBuffer(b)
+	}
+}
+
+// SafeOutput returns the contents of the stdout buffer. It is equivalent to
+// BufStdout.String(), and may be called while the command is running.
+func (cmd *Command) SafeOutput() string {
+	return cmd.BufStdout.String()
+}
+
+// CaptureStdout returns a copy of what the command has written to its stdout
+// buffer so far. It may be called while the command is running.
+func (cmd *Command) CaptureStdout() []byte {
+	return cmd.BufStdout.Bytes()
+}
+
+// CaptureStderr returns a copy of what the command has written to its stderr
+// buffer so far. It may be called while the command is running.
+func (cmd *Command) CaptureStderr() []byte {
+	return cmd.BufStderr.Bytes()
+}
+
+// stdoutCaptured returns true if the command's stdout is written to
+// BufStdout, as set up by New.
+func (cmd *Command) stdoutCaptured() bool {
+	return cmd.Stdout == cmd.BufStdout
+}
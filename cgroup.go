@@ -0,0 +1,14 @@
+package cmd
+
+// WithCgroup configures the command to be started in the cgroup (v2) whose
+// directory is at "path", e.g., "/sys/fs/cgroup/mygroup". The process is
+// placed in the cgroup as it is created, before it executes anything. The
+// current process must have permission to write to the cgroup's
+// "cgroup.procs" file.
+//
+// Cgroups are only supported on Linux. On other platforms, Start (and
+// therefore Run) will return ErrUnsupported.
+func (cmd *Command) WithCgroup(path string) *Command {
+	cmd.cgroup = path
+	return cmd
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// useCgroup configures the embedded command to be created in the cgroup
+// whose directory is at "path". The function returned must be called once
+// the command has been started.
+func (cmd *Command) useCgroup(path string) (func(), error) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not open cgroup '%s': %w", path, err)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return func() { dir.Close() }, nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package cmd
+
+func (cmd *Command) useCgroup(path string) (func(), error) {
+	return nil, ErrUnsupported
+}
@@ -1,50 +1,392 @@
 package cmd
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Command embeds a exec.Cmd but also includes buffers for stdin, stdout
 // and stderr. These buffers are automatically attached when "New" is called.
+// The buffers are safe to read while the command is running.
 type Command struct {
 	*exec.Cmd
-	BufStdin, BufStdout, BufStderr *bytes.Buffer
+	BufStdin, BufStdout, BufStderr *SafeBuffer
+
+	// PreRun, if not nil, is called by Run before the command is started.
+	// If it returns an error, then the command is not started and Run
+	// returns an error wrapping both ErrVetoed and the error from PreRun.
+	PreRun func() error
+
+	// Timeout is the maximum amount of time that the command may run once it
+	// has started before it is killed. If Timeout is zero, then the package
+	// default set by SetDefaultTimeout is used. If Timeout is negative, then
+	// the command has no timeout, even if there is a default.
+	Timeout time.Duration
+
+	// SuccessCodes is the list of exit codes that Run and Wait consider a
+	// success. When it is empty, only an exit code of 0 is a success.
+	SuccessCodes []int
+
+	// ReadsStdin marks a command that reads from the stdin of the current
+	// process. When the command is run in a pool (e.g., by RunMany), its
+	// stdin is set to os.Stdin, and it never runs at the same time as any
+	// other command with ReadsStdin set. Commands without it read from
+	// BufStdin as usual.
+	ReadsStdin bool
+
+	// Meta is arbitrary data for correlating the command with the caller's
+	// own values. It isn't used by this package, except that it is copied to
+	// the Result of the command when it is run in a pool.
+	Meta map[string]any
+
+	// name is the name of the program given to New, before it was rewritten
+	// by Wrapper. It is empty if the command wasn't created by New.
+	name string
+
+	// ctx is the context given to NewContext, if any, and ctxKilled is set
+	// when the command's process was killed because it is done.
+	ctx       context.Context
+	ctxKilled atomic.Bool
+
+	// configErr is set when the command has been configured in a way that
+	// can't work, and is returned by Start.
+	configErr error
+
+	// netns is the path to a network namespace that the command should be
+	// started in. It is empty when the command should inherit the network
+	// namespace of the current process.
+	netns string
+
+	// cgroup is the path to a cgroup (v2) directory that the command should
+	// be started in. It is empty when the command should inherit the cgroup
+	// of the current process.
+	cgroup string
+
+	// limits are the resource limits applied to the command through a
+	// transient cgroup, which is created when the command starts and
+	// removed once it has been waited on.
+	limits          *Limits
+	transientCgroup string
+
+	// secretEnvKeys are the names of environment variables whose values are
+	// hidden in the command's string representation and error messages.
+	secretEnvKeys []string
+
+	// rlimits are the resource limits set on the command's process once it
+	// has started, if any.
+	rlimits *rlimits
+
+	// background is set when the command's CPU and I/O priority should be
+	// lowered once it has started.
+	background bool
+
+	// tty is the pseudo-terminal attached to the command by WithTTY, if any.
+	tty *tty
+
+	// source is the command whose output is piped to this command's stdin,
+	// if any.
+	source *pipeSource
+
+	// expand is used to expand variables in the command's arguments when the
+	// command starts. It is nil when arguments shouldn't be expanded.
+	expand func(key string) string
+
+	// lineWriters are flushed once the command has been waited on, so that
+	// a final line without a terminator is still reported. See OnLine.
+	lineWriters []*lineWriter
+
+	// events receives the events of the command, if they were requested
+	// with Events.
+	events chan CommandEvent
+
+	// expectPos is the position in BufStdout after the last match of
+	// Expect.
+	expectPos int
+
+	// stdinBytes counts the bytes of input written to the command, and
+	// stdoutBytes and stderrBytes count the bytes of output written by the
+	// command, since it was last started.
+	stdinBytes, stdoutBytes, stderrBytes atomic.Int64
+
+	// stdin is the command's Stdin while it is wrapped to be counted, and
+	// is nil otherwise.
+	stdin io.Reader
+
+	// deadline kills the command once its timeout expires. It is nil when
+	// the command isn't running or has no timeout.
+	deadline *deadline
+
+	// done is created when the command starts and is closed once Wait has
+	// returned, at which point waitErr holds the result of Wait.
+	done    chan struct{}
+	waitErr error
+
+	// exited is created when the command starts and is closed once its
+	// process has exited and all of its output has been copied, whether or
+	// not Wait has been called, at which point exitErr holds the result of
+	// (*exec.Cmd).Wait.
+	exited  chan struct{}
+	exitErr error
 }
 
+// ErrUnsupported is returned when a command is configured to use a feature
+// that isn't available on the current platform.
+var ErrUnsupported = errors.New("not supported on this platform")
+
+// ErrVetoed is wrapped by the error returned from Run when a command's PreRun
+// function prevents it from starting.
+var ErrVetoed = errors.New("command vetoed")
+
 func (cmd *Command) String() string {
-	return strings.Join(cmd.Args, " ")
+	return cmd.redact(strings.Join(cmd.Args, " "))
+}
+
+// Arg returns the i'th argument of the command, where the 0th argument is
+// the name of the program. If there is no such argument, then Arg returns an
+// empty string.
+func (cmd *Command) Arg(i int) string {
+	if i < 0 || i >= len(cmd.Args) {
+		return ""
+	}
+	return cmd.Args[i]
 }
 
-// New creates a new pointer to a Command. Byte buffers are created and
+// NumArgs returns the number of arguments of the command, including the name
+// of the program.
+func (cmd *Command) NumArgs() int {
+	return len(cmd.Args)
+}
+
+// describe returns the quoted command for use in error messages, along with
+// its working directory if one is set.
+func (cmd *Command) describe() string {
+	if cmd.Dir != "" {
+		return fmt.Sprintf("'%s' in %s", cmd, cmd.Dir)
+	}
+	return fmt.Sprintf("'%s'", cmd)
+}
+
+// Wrapper, if not nil, is called by New (and therefore by Clone and other
+// constructors) to rewrite the name of the program and its arguments before
+// the command is created. This lets an application run every command through
+// a wrapper program, e.g., to sandbox it:
+//
+//	cmd.Wrapper = func(name string, arg []string) (string, []string) {
+//		return "firejail", append([]string{"--quiet", name}, arg...)
+//	}
+//
+// Arguments added after the command is created (e.g., with AppendArgs) are
+// added to the end of the rewritten arguments. Wrapper should be set before
+// any commands are created, since it isn't safe to change concurrently.
+var Wrapper func(name string, arg []string) (string, []string)
+
+// New creates a new pointer to a Command. Buffers are created and
 // attached to the command's Stdin, Stdout and Stderr.
 func New(name string, arg ...string) *Command {
-	stdin := new(bytes.Buffer)
-	stdout := new(bytes.Buffer)
-	stderr := new(bytes.Buffer)
+	return newCommand(nil, name, arg)
+}
 
-	cmd := exec.Command(name, arg...)
-	cmd.Stdin = stdin
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
+// NewContext is like New, except the command is created with
+// exec.CommandContext, so that its process is killed if "ctx" is done before
+// the command finishes. In that case, the error returned by Wait (or Run)
+// reports ctx.Err(), and is a *TimeoutError if the deadline of "ctx" was
+// exceeded. The command's timeout, if any, also applies.
+func NewContext(ctx context.Context, name string, arg ...string) *Command {
+	if ctx == nil {
+		panic("nil Context")
+	}
+	return newCommand(ctx, name, arg)
+}
+
+// newCommand creates a command as described by New, which is bound to "ctx"
+// if it isn't nil.
+func newCommand(ctx context.Context, name string, arg []string) *Command {
+	prog, args := name, arg
+	if Wrapper != nil {
+		prog, args = Wrapper(name, arg)
+	}
+	var ecmd *exec.Cmd
+	if ctx != nil {
+		ecmd = exec.CommandContext(ctx, prog, args...)
+	} else {
+		ecmd = exec.Command(prog, args...)
+	}
+	cmd := &Command{
+		Cmd:       ecmd,
+		name:      name,
+		ctx:       ctx,
+		BufStdin:  newBuffer(),
+		BufStdout: newBuffer(),
+		BufStderr: newBuffer(),
+	}
+	cmd.Stdin = cmd.BufStdin
+	cmd.Stdout = cmd.BufStdout
+	cmd.Stderr = cmd.BufStderr
+	if ctx != nil {
+		cmd.cancelOnDone()
+	}
+	return cmd
+}
+
+// Quick runs the named program with the given arguments and returns its
+// error, as with Run. The command's output is discarded rather than
+// captured, and it reads no input.
+func Quick(name string, arg ...string) error {
+	cmd := New(name, arg...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, nil, nil
+	return cmd.Run()
+}
+
+// Self is like New, except the command runs the executable of the current
+// process with the given arguments. This is useful for spawning worker
+// processes. The command inherits the environment of the current process.
+func Self(arg ...string) (*Command, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("Error finding the current executable: %w.",
+			err)
+	}
+	return New(exe, arg...), nil
+}
+
+// WrapCmds is a convenience function for converting a list of *exec.Cmd to a
+// list of *Command. Byte buffers are created for every command, but they are
+// only attached to the streams of the *exec.Cmd that are nil. Streams that
+// are already set are left alone.
+func WrapCmds(cmds []*exec.Cmd) []*Command {
+	lst := make([]*Command, len(cmds))
+	for i, ecmd := range cmds {
+		cmd := &Command{
+			Cmd:       ecmd,
+			BufStdin:  newBuffer(),
+			BufStdout: newBuffer(),
+			BufStderr: newBuffer(),
+		}
+		if cmd.Stdin == nil {
+			cmd.Stdin = cmd.BufStdin
+		}
+		if cmd.Stdout == nil {
+			cmd.Stdout = cmd.BufStdout
+		}
+		if cmd.Stderr == nil {
+			cmd.Stderr = cmd.BufStderr
+		}
+		lst[i] = cmd
+	}
+	return lst
+}
 
-	return &Command{
-		Cmd:       cmd,
-		BufStdin:  stdin,
-		BufStdout: stdout,
-		BufStderr: stderr,
+// Start calls (*exec.Cmd).Start on the embedded command, after applying any
+// configuration that must take effect when the process is created.
+func (cmd *Command) Start() error {
+	cmd.emit(EventStarted, "", nil)
+	if err := cmd.start(); err != nil {
+		cmd.emit(EventFinished, "", err)
+		return err
 	}
+	return nil
+}
+
+func (cmd *Command) start() error {
+	if cmd.configErr != nil {
+		return cmd.configErr
+	}
+	if cmd.expand != nil {
+		for i := 1; i < len(cmd.Args); i++ {
+			cmd.Args[i] = os.Expand(cmd.Args[i], cmd.expand)
+		}
+	}
+	cgroup := cmd.cgroup
+	if cmd.limits != nil {
+		if err := cmd.createTransientCgroup(); err != nil {
+			return err
+		}
+		cgroup = cmd.transientCgroup
+	}
+	if cgroup != "" {
+		release, err := cmd.useCgroup(cgroup)
+		if err != nil {
+			return cmd.cleanupCgroup(err)
+		}
+		defer release()
+	}
+
+	cmd.ctxKilled.Store(false)
+	restore := cmd.countStreams()
+	var err error
+	if cmd.netns != "" {
+		err = cmd.startInNetns()
+	} else {
+		err = cmd.Cmd.Start()
+	}
+	restore()
+	if cmd.tty != nil {
+		if err != nil {
+			cmd.tty.abort()
+		} else {
+			cmd.tty.started()
+		}
+	}
+	if err != nil {
+		cmd.restoreStdin()
+		if isTooManyOpenFiles(err) {
+			err = fmt.Errorf("%w: %w", ErrTooManyOpenFiles, err)
+		}
+		return cmd.cleanupCgroup(err)
+	}
+	if err := cmd.configureStarted(); err != nil {
+		cmd.Process.Kill()
+		cmd.Cmd.Wait()
+		cmd.restoreStdin()
+		return cmd.cleanupCgroup(err)
+	}
+	trackStarted(cmd.Process.Pid)
+	cmd.startDeadline()
+	cmd.done = make(chan struct{})
+	cmd.reap()
+	if cmd.source != nil {
+		cmd.source.start()
+	}
+	return nil
+}
+
+// configureStarted applies the configuration of the command that can only be
+// applied once its process exists.
+func (cmd *Command) configureStarted() error {
+	if cmd.background {
+		if err := cmd.deprioritize(); err != nil {
+			return fmt.Errorf("Could not lower priority: %w", err)
+		}
+	}
+	if cmd.rlimits != nil {
+		if err := cmd.setRlimits(); err != nil {
+			return fmt.Errorf("Could not set resource limits: %w", err)
+		}
+	}
+	return nil
 }
 
 // Run calls (*exec.Cmd).Run on the embedded command. If (*exec.Cmd).Run returns
 // an error, then Run will also return the error. But Run also checks the
 // stderr buffer, and if it isn't empty, an error is returned with the contents
 // of stderr.
+//
+// The error returned wraps the underlying error, so that, e.g., an
+// *exec.ExitError can be retrieved with errors.As.
 func (cmd *Command) Run() error {
+	if err := cmd.preRun(); err != nil {
+		return err
+	}
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("Error starting '%s': %s.", cmd, err)
+		return fmt.Errorf("Error starting %s: %w.", cmd.describe(), err)
 	}
 	if err := cmd.Wait(); err != nil {
 		return err
@@ -52,17 +394,219 @@ func (cmd *Command) Run() error {
 	return nil
 }
 
+// RunContext is like Run, except the process is killed if "ctx" is done
+// before the command finishes. In that case, the error returned reports
+// ctx.Err(), and is a *TimeoutError if the deadline of "ctx" was exceeded.
+// The command's timeout, if any, also applies.
+func (cmd *Command) RunContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		err = fmt.Errorf("Error starting %s: %w.", cmd.describe(), err)
+		cmd.emit(EventFinished, "", err)
+		return err
+	}
+	if err := cmd.preRun(); err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Error starting %s: %w.", cmd.describe(), err)
+	}
+	// As with the command's timeout, the error only reports "ctx" if the
+	// process was still running when it was killed, and so didn't fail on
+	// its own.
+	fired := make(chan struct{})
+	killed := false
+	proc := cmd.Process
+	stop := context.AfterFunc(ctx, func() {
+		defer close(fired)
+		killed = proc.Kill() == nil
+	})
+	err := cmd.Wait()
+	if !stop() {
+		<-fired
+		if err != nil && killed && cmd.terminated() && !IsTimeout(err) {
+			return cmd.killedErr(ctx, 0)
+		}
+	}
+	return err
+}
+
+// ReadAll runs the command and returns everything it wrote to stdout and
+// stderr, along with the error returned by Run. The output is returned
+// whether or not the command succeeded, so that stderr is available when
+// it fails.
+func (cmd *Command) ReadAll() (stdout, stderr []byte, err error) {
+	err = cmd.Run()
+	return cmd.BufStdout.Bytes(), cmd.BufStderr.Bytes(), err
+}
+
+// preRun calls the command's PreRun function, if there is one.
+func (cmd *Command) preRun() error {
+	if cmd.PreRun == nil {
+		return nil
+	}
+	if err := cmd.PreRun(); err != nil {
+		err = fmt.Errorf("Error starting %s: %w: %w.",
+			cmd.describe(), ErrVetoed, err)
+		cmd.emit(EventFinished, "", err)
+		return err
+	}
+	return nil
+}
+
 // Wait calls (*exec.Cmd).Wait on the embedded command and handles errors
 // as described in Run().
-// Note that you may call (*Command).Start() since the Command type embeds a
-// *exec.Cmd type.
+// Wait should be used with (*Command).Start().
 func (cmd *Command) Wait() error {
-	if err := cmd.Cmd.Wait(); err != nil {
-		if cmd.BufStderr.Len() > 0 {
-			return fmt.Errorf("Error running '%s': %s.\n\n%s",
-				cmd, err, cmd.BufStderr.String())
+	err := cmd.stopDeadline(cmd.wait())
+	cmd.restoreStdin()
+	if cmd.tty != nil {
+		cmd.tty.finish()
+	}
+	if cmd.source != nil {
+		err = cmd.source.wait(err)
+	}
+	for _, lw := range cmd.lineWriters {
+		lw.flush()
+	}
+	if cmd.Process != nil {
+		trackWaited(cmd.Process.Pid)
+	}
+	if rmErr := cmd.removeTransientCgroup(); rmErr != nil {
+		rmErr = fmt.Errorf("Error running %s: %w.", cmd.describe(), rmErr)
+		err = errors.Join(err, rmErr)
+	}
+	if cmd.done != nil {
+		select {
+		case <-cmd.done:
+		default:
+			cmd.waitErr = err
+			close(cmd.done)
 		}
-		return fmt.Errorf("Error running '%s': %s.", cmd, err)
+	}
+	cmd.emit(EventFinished, "", err)
+	return err
+}
+
+// Done returns a channel that is closed once Wait has returned for a started
+// command. Done returns nil if the command hasn't been started, so that
+// receiving from it blocks forever.
+//
+// Note that the channel is only closed when Wait (or Run) is called. Done does
+// not wait on the process itself.
+func (cmd *Command) Done() <-chan struct{} {
+	return cmd.done
+}
+
+// Err returns the error returned by Wait once the channel returned by Done
+// is closed. Before then, Err returns nil.
+func (cmd *Command) Err() error {
+	select {
+	case <-cmd.done:
+		return cmd.waitErr
+	default:
+		return nil
+	}
+}
+
+var (
+	// ErrNotStarted is returned by ExitCode when the command hasn't been
+	// started.
+	ErrNotStarted = errors.New("command not started")
+
+	// ErrNotWaited is returned by ExitCode when the command has been started
+	// but not waited on.
+	ErrNotWaited = errors.New("command not waited on")
+)
+
+// ExitCode returns the exit code of the command once it has been waited on
+// (e.g., by Run or Wait). If the process was terminated by a signal, then
+// the exit code is -1.
+func (cmd *Command) ExitCode() (int, error) {
+	if cmd.Process == nil {
+		return 0, ErrNotStarted
+	}
+	// The process may have exited already, but its ProcessState is only
+	// safe to read once Wait has returned.
+	select {
+	case <-cmd.done:
+	default:
+		if cmd.done != nil || cmd.ProcessState == nil {
+			return 0, ErrNotWaited
+		}
+	}
+	return cmd.ProcessState.ExitCode(), nil
+}
+
+// reap waits for the started command's process to exit in the background,
+// so that its exit can be noticed (e.g., by Expect) before Wait is called.
+func (cmd *Command) reap() {
+	exited := make(chan struct{})
+	cmd.exited = exited
+	tty := cmd.tty
+	go func() {
+		defer close(exited)
+
+		cmd.exitErr = cmd.Cmd.Wait()
+		if tty != nil {
+			<-tty.copied
+		}
+	}()
+}
+
+// exitStatus returns the result of (*exec.Cmd).Wait, once the process has
+// exited.
+func (cmd *Command) exitStatus() error {
+	if cmd.exited == nil {
+		return cmd.Cmd.Wait()
+	}
+	select {
+	case <-cmd.done:
+		// Wait has already returned, so (*exec.Cmd).Wait reports that it
+		// was already called.
+		return cmd.Cmd.Wait()
+	default:
+	}
+	<-cmd.exited
+	return cmd.exitErr
+}
+
+func (cmd *Command) wait() error {
+	if err := cmd.checkExitCode(cmd.exitStatus()); err != nil {
+		return fmt.Errorf("Error running %s: %w.%s",
+			cmd.describe(), err, cmd.stderrDetail())
 	}
 	return nil
 }
+
+// stderrDetail returns what follows the message of an error returned by Wait:
+// the contents of the stderr buffer, if there are any, after a blank line.
+func (cmd *Command) stderrDetail() string {
+	if cmd.BufStderr.Len() == 0 {
+		return ""
+	}
+	return "\n\n" + cmd.redact(cmd.BufStderr.String())
+}
+
+// checkExitCode applies the command's SuccessCodes to "err", which is the
+// error returned by (*exec.Cmd).Wait.
+func (cmd *Command) checkExitCode(err error) error {
+	if len(cmd.SuccessCodes) == 0 || cmd.ProcessState == nil {
+		return err
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+
+	// A process terminated by a signal has no exit code.
+	code := cmd.ProcessState.ExitCode()
+	switch {
+	case code < 0:
+		return err
+	case slices.Contains(cmd.SuccessCodes, code):
+		return nil
+	case err == nil:
+		return fmt.Errorf("exit status %d", code)
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import "math/rand/v2"
+
+// Shuffle returns a copy of the list of commands in a pseudo-random order
+// determined by "seed". The same seed always produces the same order, which
+// makes Shuffle suitable for reproducible tests.
+func (cmds Commands) Shuffle(seed int64) Commands {
+	return cmds.shuffle(rand.New(rand.NewPCG(uint64(seed), 0)))
+}
+
+// Randomize returns a copy of the list of commands in a random order. Unlike
+// Shuffle, the order is not reproducible across runs.
+func (cmds Commands) Randomize() Commands {
+	return cmds.shuffle(nil)
+}
+
+// shuffle returns a shuffled copy of "cmds" using "r", or the global source
+// if "r" is nil.
+func (cmds Commands) shuffle(r *rand.Rand) Commands {
+	lst := make(Commands, len(cmds))
+	copy(lst, cmds)
+
+	swap := func(i, j int) { lst[i], lst[j] = lst[j], lst[i] }
+	if r == nil {
+		rand.Shuffle(len(lst), swap)
+	} else {
+		r.Shuffle(len(lst), swap)
+	}
+	return lst
+}
+
+// GroupBy partitions the list of commands into groups, where the group of
+// each command is the string returned by "key". Every command appears in
+// exactly one group, and the commands in each group are in the same relative
+// order as they appear in "cmds".
+func (cmds Commands) GroupBy(key func(Commander) string) map[string]Commands {
+	groups := make(map[string]Commands)
+	for _, c := range cmds {
+		k := key(c)
+		groups[k] = append(groups[k], c)
+	}
+	return groups
+}
+
+// Take returns the first "n" commands, or all of them if there are fewer
+// than "n". The list returned shares its underlying array with "cmds".
+func (cmds Commands) Take(n int) Commands {
+	return cmds[:clamp(n, len(cmds))]
+}
+
+// Skip returns every command except the first "n", or an empty list if there
+// are no more than "n". The list returned shares its underlying array with
+// "cmds".
+func (cmds Commands) Skip(n int) Commands {
+	return cmds[clamp(n, len(cmds)):]
+}
+
+// ToSlice returns the list of commands as a []Commander, e.g., for passing
+// to a variadic function that takes ...Commander. The slice returned shares
+// its underlying array with "cmds".
+func (cmds Commands) ToSlice() []Commander {
+	return []Commander(cmds)
+}
+
+// Len returns the number of commands in the list.
+func (cmds Commands) Len() int {
+	return len(cmds)
+}
+
+// IsEmpty reports whether the list has no commands.
+func (cmds Commands) IsEmpty() bool {
+	return len(cmds) == 0
+}
+
+// First returns the first command, or false if there are none.
+func (cmds Commands) First() (Commander, bool) {
+	return cmds.At(0)
+}
+
+// Last returns the last command, or false if there are none.
+func (cmds Commands) Last() (Commander, bool) {
+	return cmds.At(len(cmds) - 1)
+}
+
+// At returns the command at index "i", or false if there is no such
+// command.
+func (cmds Commands) At(i int) (Commander, bool) {
+	if i < 0 || i >= len(cmds) {
+		return nil, false
+	}
+	return cmds[i], true
+}
+
+// clamp returns "n" limited to the range [0, limit].
+func clamp(n, limit int) int {
+	if n < 0 {
+		return 0
+	}
+	if n > limit {
+		return limit
+	}
+	return n
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"runtime"
+	"time"
+)
+
+// ElasticPool is like Pool, except the number of workers changes with the
+// amount of work. It starts with a minimum number of workers, and more are
+// started (up to a maximum) when commands are submitted faster than they
+// can be run. Workers beyond the minimum stop once they have been idle for
+// a while.
+//
+// An ElasticPool must be created with NewElasticPool, and should be closed
+// with Close once no more commands will be submitted.
+type ElasticPool struct {
+	workerPool
+	min, max    int
+	idleTimeout time.Duration
+	// running is the number of workers, and waiting is the number of them
+	// that are waiting for a command.
+	running int
+	waiting int
+}
+
+// NewElasticPool creates a new pool and starts "min" workers. Up to "max"
+// workers are run at a time, and a worker beyond the first "min" stops once
+// it has waited "idleTimeout" for a command without receiving one. If "max"
+// is less than 1, then the value of GOMAXPROCS is used. "min" is clamped to
+// the range [0, max].
+func NewElasticPool(min, max int, idleTimeout time.Duration) *ElasticPool {
+	if max < 1 {
+		max = runtime.GOMAXPROCS(0)
+	}
+	p := &ElasticPool{
+		min:         clamp(min, max),
+		max:         max,
+		idleTimeout: idleTimeout,
+	}
+	p.init()
+	for i := 0; i < p.min; i++ {
+		p.spawn()
+	}
+	return p
+}
+
+// Submit queues "cmd" to be run by one of the pool's workers. If there are
+// more queued commands than idle workers, then a new worker is started,
+// unless the pool already has its maximum number of workers. Submit never
+// blocks. The Future returned can be used to wait for "cmd" to finish.
+//
+// If the pool has been closed, then "cmd" is not run and the Future's error
+// is ErrPoolClosed.
+func (p *ElasticPool) Submit(cmd Commander) *Future {
+	return p.submit(cmd, func() {
+		if len(p.queue) > p.waiting && p.running < p.max {
+			p.spawn()
+		} else {
+			p.ready.Signal()
+		}
+	})
+}
+
+// Workers returns the number of workers currently running.
+func (p *ElasticPool) Workers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.running
+}
+
+// spawn starts a new worker. The pool's lock must be held.
+func (p *ElasticPool) spawn() {
+	p.running++
+	p.workers.Add(1)
+	go p.serve(p.take)
+}
+
+// take removes and returns the next queued command, waiting for one if
+// necessary. It returns nil when the worker should stop, either because the
+// pool has been closed or because the worker has been idle for too long and
+// there are more than the minimum number of workers, in which case the
+// worker is no longer counted as running. The pool's lock must be held.
+func (p *ElasticPool) take() *Future {
+	idleSince := time.Now()
+	for len(p.queue) == 0 {
+		remaining := p.idleTimeout - time.Since(idleSince)
+		if p.closed || (remaining <= 0 && p.running > p.min) {
+			p.running--
+			return nil
+		}
+
+		var timer *time.Timer
+		if remaining > 0 && p.running > p.min {
+			timer = time.AfterFunc(remaining, func() {
+				p.mu.Lock()
+				p.ready.Broadcast()
+				p.mu.Unlock()
+			})
+		}
+		p.waiting++
+		p.ready.Wait()
+		p.waiting--
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+	f := p.queue[0]
+	p.queue = p.queue[1:]
+	return f
+}
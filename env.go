@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ClearEnv clears the command's environment, so that the command doesn't
+// inherit the environment of the current process. Variables may be added
+// back with AddEnv.
+func (cmd *Command) ClearEnv() *Command {
+	cmd.Env = []string{}
+	return cmd
+}
+
+// AddEnv adds the environment variable key=value to the command's
+// environment. If the command's environment hasn't been set, then it starts
+// from the environment of the current process. (If ClearEnv has been called,
+// the variable is added to the empty environment instead.)
+func (cmd *Command) AddEnv(key, value string) *Command {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, key+"="+value)
+	return cmd
+}
+
+// PrependPath puts "dir" at the front of the PATH environment variable of
+// the command, so that programs in "dir" take precedence over programs of the
+// same name elsewhere. The current value of PATH is taken from the
+// command's environment if it has been set, and from the environment of the
+// current process otherwise.
+//
+// If the command's program was given by name, rather than by a path, and
+// "dir" contains an executable with that name, then the command runs it.
+// (Otherwise, the program is still the one found when the command was
+// created.) It must be called before the command is started.
+func (cmd *Command) PrependPath(dir string) *Command {
+	path, ok := cmd.lookupEnv("PATH")
+	if ok && path != "" {
+		path = dir + string(os.PathListSeparator) + path
+	} else {
+		path = dir
+	}
+	cmd.AddEnv("PATH", path)
+
+	name := cmd.Path
+	switch {
+	case len(cmd.Args) > 0:
+		name = cmd.Args[0]
+	case cmd.name != "":
+		name = cmd.name
+	}
+	if name != "" && !strings.ContainsAny(name, `/\`) {
+		if lp, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			cmd.Path = lp
+			cmd.Cmd.Err = nil
+		}
+	}
+	return cmd
+}
+
+// lookupEnv returns the value of the variable "key" in the command's
+// environment, or in the environment of the current process if the
+// command's environment hasn't been set.
+func (cmd *Command) lookupEnv(key string) (string, bool) {
+	if cmd.Env == nil {
+		return os.LookupEnv(key)
+	}
+	// As in os/exec, the last value of a variable is the one used.
+	for i := len(cmd.Env) - 1; i >= 0; i-- {
+		k, v, ok := strings.Cut(cmd.Env[i], "=")
+		if ok && (k == key ||
+			(runtime.GOOS == "windows" && strings.EqualFold(k, key))) {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// ErrInvalidEnv is returned by Start when a command was given an
+// environment variable that isn't of the form KEY=VALUE.
+var ErrInvalidEnv = errors.New("invalid environment variable")
+
+// WithPrependedEnv inserts "vars", each of the form KEY=VALUE, at the start
+// of the command's environment. If the command's environment hasn't been
+// set, then it starts from the environment of the current process.
+//
+// Since os/exec only passes one value for each variable to the command, any
+// value later in the environment for a variable in "vars" is removed, so
+// that the values in "vars" take precedence.
+//
+// If any of "vars" isn't of the form KEY=VALUE, then the environment is left
+// alone and Start (and therefore Run) returns an error wrapping
+// ErrInvalidEnv.
+func (cmd *Command) WithPrependedEnv(vars ...string) *Command {
+	if !cmd.validEnv(vars) {
+		return cmd
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	keys := make(map[string]bool, len(vars))
+	for _, kv := range vars {
+		key, _, _ := strings.Cut(kv, "=")
+		keys[key] = true
+	}
+	env := append([]string(nil), vars...)
+	for _, kv := range cmd.Env {
+		if key, _, _ := strings.Cut(kv, "="); !keys[key] {
+			env = append(env, kv)
+		}
+	}
+	cmd.Env = env
+	return cmd
+}
+
+// WithAppendedEnv appends "vars", each of the form KEY=VALUE, to the end of
+// the command's environment, as with AddEnv. The values in "vars" take
+// precedence over any earlier value for the same variable.
+//
+// If any of "vars" isn't of the form KEY=VALUE, then the environment is left
+// alone and Start (and therefore Run) returns an error wrapping
+// ErrInvalidEnv.
+func (cmd *Command) WithAppendedEnv(vars ...string) *Command {
+	if !cmd.validEnv(vars) {
+		return cmd
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, vars...)
+	return cmd
+}
+
+// validEnv reports whether every variable in "vars" is of the form
+// KEY=VALUE, where KEY is not empty. (VALUE may contain "=".) If one isn't,
+// then the command's configuration error is set.
+func (cmd *Command) validEnv(vars []string) bool {
+	for _, kv := range vars {
+		if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+			cmd.configErr = fmt.Errorf("%w: %q", ErrInvalidEnv, kv)
+			return false
+		}
+	}
+	return true
+}
+
+// WithEnvFile adds the environment variables in the dotenv file at "path" to
+// the command's environment, as with AddEnv. A variable that is already set
+// in the command's environment (or earlier in the file) is not overridden.
+//
+// Each line of the file has the form KEY=VALUE, optionally preceded by
+// "export". Blank lines and lines starting with "#" are ignored. A value
+// enclosed in single quotes is used literally. A value enclosed in double
+// quotes may contain escaped quotes (\") and backslashes (\\), along with
+// \n for a new line. A quoted value may only be followed by a comment.
+// Otherwise, the value ends at a "#" preceded by a space, and surrounding
+// space is trimmed. If the file can't be read or parsed, then the command's
+// environment is left unchanged, and the command is returned along with the
+// error.
+func (cmd *Command) WithEnvFile(path string) (*Command, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cmd, fmt.Errorf("Error reading environment file: %w.", err)
+	}
+	defer f.Close()
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	set := make(map[string]bool, len(env))
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		set[key] = true
+	}
+	// The command's environment is only changed once the whole file has
+	// been parsed, so that it isn't left half applied by an error.
+	var added []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return cmd, fmt.Errorf("Error parsing %s on line %d: "+
+				"expected KEY=VALUE.", path, n)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return cmd, fmt.Errorf("Error parsing %s on line %d: %w.",
+				path, n, err)
+		}
+		if !set[key] {
+			set[key] = true
+			added = append(added, key+"="+value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return cmd, fmt.Errorf("Error reading environment file: %w.", err)
+	}
+	cmd.Env = append(env, added...)
+	return cmd, nil
+}
+
+// parseEnvValue returns the value of a variable in a dotenv file, where "s"
+// is everything after the "=" with surrounding space removed.
+func parseEnvValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, "'"):
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", errors.New("unterminated single quote")
+		}
+		return s[1 : end+1], afterQuote(s[end+2:])
+	case strings.HasPrefix(s, `"`):
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '"':
+				return b.String(), afterQuote(s[i+1:])
+			case c == '\\' && i+1 < len(s):
+				i++
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case '"', '\\':
+					b.WriteByte(s[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(s[i])
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return "", errors.New("unterminated double quote")
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// afterQuote returns an error if "rest", which follows the closing quote of
+// a value in a dotenv file, is anything other than space and a comment.
+func afterQuote(rest string) error {
+	trimmed := strings.TrimSpace(rest)
+	if trimmed == "" || (trimmed[0] == '#' && len(trimmed) < len(rest)) {
+		return nil
+	}
+	return fmt.Errorf("unexpected %q after closing quote", trimmed)
+}
+
+// WithEnvExpansion causes $var and ${var} references in the command's
+// arguments to be replaced with the values of environment variables in the
+// current process when the command is started. Unset variables are replaced
+// with the empty string. The name of the program (Args[0]) is never
+// expanded.
+//
+// Since no shell is involved, the expanded values are never split or
+// otherwise interpreted.
+func (cmd *Command) WithEnvExpansion() *Command {
+	cmd.expand = os.Getenv
+	return cmd
+}
+
+// WithEnvExpansionMap is like WithEnvExpansion, except variables are looked
+// up in "env" instead of the environment of the current process.
+func (cmd *Command) WithEnvExpansionMap(env map[string]string) *Command {
+	cmd.expand = func(key string) string {
+		return env[key]
+	}
+	return cmd
+}
+
+// WithSecretEnvVar is like AddEnv, except the value of the variable is
+// treated as a secret: anywhere it appears in the command's string
+// representation or in its error messages (including the contents of stderr),
+// it is replaced with "***".
+//
+// Values shorter than 8 bytes (e.g., "1" or "true") would also match
+// unrelated output, so they are only replaced where they appear as
+// KEY=VALUE.
+func (cmd *Command) WithSecretEnvVar(key, value string) *Command {
+	cmd.secretEnvKeys = append(cmd.secretEnvKeys, key)
+	return cmd.AddEnv(key, value)
+}
+
+// minSecretLen is the length of the shortest secret value that redact
+// replaces wherever it appears, rather than only as KEY=VALUE.
+const minSecretLen = 8
+
+// redact replaces the value of every secret environment variable in "s"
+// with "***", as described by WithSecretEnvVar.
+func (cmd *Command) redact(s string) string {
+	for _, key := range cmd.secretEnvKeys {
+		for _, kv := range cmd.Env {
+			value, ok := strings.CutPrefix(kv, key+"=")
+			if !ok || value == "" {
+				continue
+			}
+			s = strings.ReplaceAll(s, kv, key+"=***")
+			if len(value) >= minSecretLen {
+				s = strings.ReplaceAll(s, value, "***")
+			}
+		}
+	}
+	return s
+}
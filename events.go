@@ -0,0 +1,81 @@
+package cmd
+
+import "time"
+
+// EventType is the kind of a CommandEvent.
+type EventType int
+
+const (
+	// EventStarted is sent when the command is started.
+	EventStarted EventType = iota
+	// EventLine is sent for every line the command writes to stdout.
+	EventLine
+	// EventFinished is sent when the command has been waited on, or when it
+	// couldn't be started (e.g., because PreRun vetoed it). It is always the
+	// last event.
+	EventFinished
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventLine:
+		return "line"
+	case EventFinished:
+		return "finished"
+	}
+	return "unknown"
+}
+
+// CommandEvent is an event in the lifecycle of a command. See Events.
+type CommandEvent struct {
+	Type EventType
+	Cmd  *Command
+	// Line is the line of stdout, without its line terminator, for an
+	// EventLine.
+	Line string
+	// Err is the error returned by Wait (or Start, if it failed) for an
+	// EventFinished.
+	Err error
+	At  time.Time
+}
+
+// eventBuffer is the capacity of the channel returned by Events.
+const eventBuffer = 64
+
+// Events returns a channel that receives the events of the command as it
+// runs: EventStarted when Start is called, then EventLine for every line
+// written to stdout (which is still written to BufStdout as usual), then
+// EventFinished once Wait has returned. The channel is closed after
+// EventFinished. Events must be called before the command is started.
+//
+// The channel is buffered, but the command blocks when it's full, so the
+// caller must receive every event until the channel is closed.
+func (cmd *Command) Events() <-chan CommandEvent {
+	if cmd.events == nil {
+		cmd.events = make(chan CommandEvent, eventBuffer)
+		lw := &lineWriter{fn: func(line string) {
+			cmd.emit(EventLine, line, nil)
+		}}
+		cmd.Stdout = teeWriter(cmd.Stdout, lw)
+		cmd.lineWriters = append(cmd.lineWriters, lw)
+	}
+	return cmd.events
+}
+
+// emit sends an event, if events were requested with Events. Once
+// EventFinished has been sent, the channel is closed and no more events are
+// sent.
+func (cmd *Command) emit(typ EventType, line string, err error) {
+	if cmd.events == nil {
+		return
+	}
+	cmd.events <- CommandEvent{
+		Type: typ, Cmd: cmd, Line: line, Err: err, At: time.Now(),
+	}
+	if typ == EventFinished {
+		close(cmd.events)
+		cmd.events = nil
+	}
+}
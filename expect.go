@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ErrExpectTimeout is wrapped by the error returned from Expect when the
+// command's output doesn't match before the timeout.
+var ErrExpectTimeout = errors.New("timed out waiting for output")
+
+// expectPollInterval is how often Expect checks for new output.
+const expectPollInterval = 10 * time.Millisecond
+
+// Expect waits until the output of the started command (in BufStdout)
+// matches "re", and returns the text that matched. Each call only considers
+// output after the end of the previous match, so that a command can be
+// driven interactively, e.g., by waiting for a prompt and then writing a
+// line with StdinWriter.
+//
+// If the output doesn't match within "timeout", or if the command's process
+// has exited (whether or not it has been waited on) and its output doesn't
+// match, then an error is returned. The error wraps ErrExpectTimeout in the
+// former case.
+func (cmd *Command) Expect(re *regexp.Regexp,
+	timeout time.Duration) (string, error) {
+
+	deadline := time.Now().Add(timeout)
+	if cmd.expectPos > cmd.BufStdout.Len() {
+		cmd.expectPos = 0
+	}
+	// out is the output after the end of the previous match. Only output
+	// added since the last check is copied from the buffer. A match may
+	// start anywhere in "out", so the whole of it is searched, but only when
+	// output has been added.
+	var out []byte
+	for first := true; ; first = false {
+		// Check whether the process has exited before looking at the
+		// output, so that no output is missed if it exits in between. Its
+		// output has all been copied once it has exited.
+		exited := false
+		select {
+		case <-cmd.exited:
+			exited = true
+		default:
+		}
+
+		added := cmd.BufStdout.bytesFrom(cmd.expectPos + len(out))
+		out = append(out, added...)
+		if first || len(added) > 0 {
+			if loc := re.FindIndex(out); loc != nil {
+				cmd.expectPos += loc[1]
+				return string(out[loc[0]:loc[1]]), nil
+			}
+		}
+		switch {
+		case exited:
+			return "", fmt.Errorf("Error waiting for %s to output %q: "+
+				"command exited.", cmd.describe(), re)
+		case !time.Now().Before(deadline):
+			return "", fmt.Errorf("Error waiting for %s to output %q: %w.",
+				cmd.describe(), re, ErrExpectTimeout)
+		}
+		time.Sleep(min(expectPollInterval, time.Until(deadline)))
+	}
+}
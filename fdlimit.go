@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"runtime"
+)
+
+// ErrTooManyOpenFiles is wrapped by the error returned from Start when the
+// command couldn't be started because the current process (or the system)
+// ran out of file descriptors. Each running command uses several file
+// descriptors for its pipes, so this usually means that too many commands
+// are being run at once. See RunManyFDLimited.
+var ErrTooManyOpenFiles = errors.New(
+	"too many open files, consider running fewer commands at once")
+
+// fdsPerCommand is a generous estimate of the number of file descriptors
+// used by each running command: both ends of a pipe for each of stdin,
+// stdout and stderr, plus one used by os/exec while starting the process.
+const fdsPerCommand = 8
+
+// RunManyFDLimited is like RunMany, except the number of workers is capped
+// so that the commands running at once can't exhaust the soft limit on the
+// number of open files (RLIMIT_NOFILE) of the current process. The cap takes
+// into account the files that are already open. At least one worker is
+// always used.
+//
+// The limit is only known on Unix. On other platforms, RunManyFDLimited is
+// the same as RunMany.
+func (cmds Commands) RunManyFDLimited(workers int) []error {
+	return cmds.RunMany(fdLimitWorkers(workers))
+}
+
+// fdLimitWorkers returns "workers" capped by the number of commands that can
+// run at once without exceeding the limit on open files. If "workers" is
+// less than 1, then it is capped starting from GOMAXPROCS, as in RunMany.
+func fdLimitWorkers(workers int) int {
+	limit, ok := openFileLimit()
+	if !ok {
+		return workers
+	}
+	// Assume a handful of files are open if they can't be counted.
+	open := uint64(16)
+	if entries, err := os.ReadDir("/dev/fd"); err == nil {
+		open = uint64(len(entries))
+	}
+	capped := 1
+	if limit > open {
+		capped = max(1, int(min((limit-open)/fdsPerCommand, 1<<20)))
+	}
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return min(workers, capped)
+}
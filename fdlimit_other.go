@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cmd
+
+func openFileLimit() (uint64, bool) {
+	return 0, false
+}
+
+func isTooManyOpenFiles(err error) bool {
+	return false
+}
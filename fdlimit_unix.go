@@ -0,0 +1,24 @@
+//go:build unix
+
+package cmd
+
+import (
+	"errors"
+	"syscall"
+)
+
+// openFileLimit returns the soft limit on the number of open files of the
+// current process.
+func openFileLimit() (uint64, bool) {
+	var rlim syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlim); err != nil {
+		return 0, false
+	}
+	return uint64(rlim.Cur), true
+}
+
+// isTooManyOpenFiles reports whether "err" is from running out of file
+// descriptors.
+func isTooManyOpenFiles(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
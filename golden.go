@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExpectOutput runs the command and returns an error if it fails, or if
+// what it writes to stdout is not exactly "want". In the latter case, the
+// error includes a line-by-line diff of "want" and the actual output.
+//
+// This is useful for comparing the output of a command against a golden
+// file in tests.
+func (cmd *Command) ExpectOutput(want string) error {
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	got := cmd.BufStdout.String()
+	if got == want {
+		return nil
+	}
+	return fmt.Errorf("Unexpected output from %s:\n--- want\n+++ got\n%s",
+		cmd.describe(), lineDiff(want, got))
+}
+
+// ExpectExitCode runs the command and returns an error if it doesn't exit
+// with the given exit code. An error is also returned if the command can't
+// be started, or if it is terminated by a signal.
+func (cmd *Command) ExpectExitCode(code int) error {
+	err := cmd.Run()
+	if cmd.ProcessState == nil {
+		return err
+	}
+	if got := cmd.ProcessState.ExitCode(); got != code {
+		return fmt.Errorf("Unexpected exit code from %s: want %d, got %d.",
+			cmd.describe(), code, got)
+	}
+	return nil
+}
+
+// lineDiff returns the lines in "a" and "b", where lines only in "a" are
+// prefixed with "-", lines only in "b" are prefixed with "+" and lines in
+// both are prefixed with " ".
+func lineDiff(a, b string) string {
+	x, y := splitLines(a), splitLines(b)
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	line := func(prefix, s string) {
+		diff.WriteString(prefix)
+		diff.WriteString(s)
+		if !strings.HasSuffix(s, "\n") {
+			diff.WriteString("\n\\ No newline at end\n")
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			line(" ", x[i])
+			i, j = i+1, j+1
+		case j == len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+			line("-", x[i])
+			i++
+		default:
+			line("+", y[j])
+			j++
+		}
+	}
+	return diff.String()
+}
+
+// splitLines splits "s" into lines, keeping the line terminators.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
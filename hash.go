@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// OutputSHA256 runs the command and returns the SHA-256 hash of everything
+// it writes to stdout. The output is hashed as it arrives and is not written
+// to BufStdout, so that arbitrarily large output can be hashed without
+// keeping it in memory.
+//
+// An error is returned without running the command if its stdout has been
+// redirected away from BufStdout.
+func (cmd *Command) OutputSHA256() ([]byte, error) {
+	if !cmd.stdoutCaptured() {
+		return nil, fmt.Errorf("Error running %s: stdout is redirected, "+
+			"so it can't be hashed.", cmd.describe())
+	}
+
+	h := sha256.New()
+	orig := cmd.Stdout
+	cmd.Stdout = h
+	defer func() { cmd.Stdout = orig }()
+
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// OutputSHA256String is like OutputSHA256, except the hash is returned
+// encoded as a hexadecimal string.
+func (cmd *Command) OutputSHA256String() (string, error) {
+	sum, err := cmd.OutputSHA256()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"context"
+	"time"
+)
+
+// WaitUntilSuccess runs the command returned by "factory" every "interval"
+// until one of them succeeds, in which case nil is returned. If "ctx" is done
+// before a command succeeds, then ctx.Err() is returned.
+//
+// The first command is run immediately. "factory" is called for every
+// attempt, since a Commander can't generally be run more than once.
+//
+// This is useful for readiness checks, e.g.,
+//
+//	err := WaitUntilSuccess(ctx, time.Second, func() Commander {
+//		return New("pg_isready")
+//	})
+func WaitUntilSuccess(ctx context.Context, interval time.Duration,
+	factory func() Commander) error {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := factory().Run(); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInvalidJSON is wrapped by the error returned from RunJSON when the
+// command succeeded but its output couldn't be decoded.
+var ErrInvalidJSON = errors.New("invalid JSON output")
+
+// RunJSON runs the command and decodes its stdout (from BufStdout) as a list
+// of values of type T. The output may be either a JSON array or a stream of
+// JSON values, e.g., newline delimited JSON (NDJSON).
+//
+// If the command fails, then the error returned by Run is returned. If the
+// output can't be decoded, then the error wraps ErrInvalidJSON.
+func RunJSON[T any](cmd *Command) ([]T, error) {
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	out := cmd.BufStdout.Bytes()
+	values, err := decodeJSON[T](out)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding the output of %s: %w: %w.",
+			cmd.describe(), ErrInvalidJSON, err)
+	}
+	return values, nil
+}
+
+// decodeJSON decodes "data" as either a JSON array of T, or a stream of
+// JSON values of T.
+func decodeJSON[T any](data []byte) ([]T, error) {
+	values := []T{}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		if err := json.Unmarshal(data, &values); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var v T
+		if err := dec.Decode(&v); err == io.EOF {
+			return values, nil
+		} else if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"slices"
+	"sync"
+)
+
+// started is the set of process ids of commands that have been started but
+// not waited on.
+var started = struct {
+	sync.Mutex
+	pids map[int]bool
+}{pids: make(map[int]bool)}
+
+// LeakedPIDs returns the process ids, in ascending order, of every command
+// that has been started but not waited on. It is meant to help find missing
+// calls to Wait, which leave zombie processes behind.
+//
+// Only commands started through (*Command).Start (including by Run) are
+// tracked.
+func LeakedPIDs() []int {
+	started.Lock()
+	defer started.Unlock()
+
+	pids := make([]int, 0, len(started.pids))
+	for pid := range started.pids {
+		pids = append(pids, pid)
+	}
+	slices.Sort(pids)
+	return pids
+}
+
+func trackStarted(pid int) {
+	started.Lock()
+	defer started.Unlock()
+
+	started.pids[pid] = true
+}
+
+func trackWaited(pid int) {
+	started.Lock()
+	defer started.Unlock()
+
+	delete(started.pids, pid)
+}
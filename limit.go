@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+)
+
+// TruncatedMarker is written to a command's output in place of anything
+// that was dropped because an output limit was exceeded.
+const TruncatedMarker = "\n[output truncated]\n"
+
+// RunManyMaxOutput is like RunMany, except the total number of bytes of
+// output captured across all commands is limited to "maxTotalBytes". Once
+// the limit is reached, any further output from any command is dropped and
+// TruncatedMarker is written in its place (once per stream). The commands'
+// stdout and stderr are restored once they have finished.
+//
+// Only the output of *Command and *exec.Cmd values can be limited. Other
+// commands are run as usual. If "maxTotalBytes" is less than 0, then there
+// is no limit.
+func (cmds Commands) RunManyMaxOutput(workers int,
+	maxTotalBytes int64) []error {
+
+	if maxTotalBytes >= 0 {
+		total := new(atomic.Int64)
+		limited := func(w io.Writer) io.Writer {
+			return &limitWriter{w: w, total: total, max: maxTotalBytes}
+		}
+		for _, c := range cmds {
+			var ecmd *exec.Cmd
+			switch c := c.(type) {
+			case *Command:
+				ecmd = c.Cmd
+			case *exec.Cmd:
+				ecmd = c
+			default:
+				continue
+			}
+			stdout, stderr := ecmd.Stdout, ecmd.Stderr
+			defer func() {
+				ecmd.Stdout, ecmd.Stderr = stdout, stderr
+			}()
+			if stdout != nil {
+				ecmd.Stdout = limited(stdout)
+			}
+			if stderr == stdout {
+				// os/exec shares a single pipe when both streams are the
+				// same writer, so they share a single limit as well.
+				ecmd.Stderr = ecmd.Stdout
+			} else if stderr != nil {
+				ecmd.Stderr = limited(stderr)
+			}
+		}
+	}
+	return cmds.RunMany(workers)
+}
+
+// limitWriter writes to "w" until the shared "total" reaches "max". After
+// that, writes are dropped.
+type limitWriter struct {
+	w         io.Writer
+	total     *atomic.Int64
+	max       int64
+	truncated bool
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.truncated {
+		return len(p), nil
+	}
+
+	// Reserve room for as much of "p" as fits under the limit, so that
+	// concurrent writers never see a reservation for output that is then
+	// dropped.
+	var n int64
+	for {
+		total := w.total.Load()
+		n = min(int64(len(p)), max(w.max-total, 0))
+		if w.total.CompareAndSwap(total, total+n) {
+			break
+		}
+	}
+	w.truncated = n < int64(len(p))
+	if _, err := w.w.Write(p[:n]); err != nil {
+		return 0, err
+	}
+	if w.truncated {
+		if _, err := io.WriteString(w.w, TruncatedMarker); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// countStreams counts the bytes read from the command's stdin and written to
+// its stdout and stderr while it runs. It returns a function that restores
+// stdout and stderr, which is called once the command has started, since
+// os/exec only needs them then. Stdin is read by os/exec while the command
+// runs, so it is restored by restoreStdin once the command has been waited on
+// (or has failed to start).
+//
+// Streams that are nil or an *os.File are given to the process directly, so
+// they aren't counted. Wrapping them would replace the file with a pipe.
+func (cmd *Command) countStreams() (restore func()) {
+	stdout, stderr := cmd.Stdout, cmd.Stderr
+	cmd.stdinBytes.Store(0)
+	cmd.stdoutBytes.Store(0)
+	cmd.stderrBytes.Store(0)
+	if countable(cmd.Stdin) {
+		cmd.stdin = cmd.Stdin
+		cmd.Stdin = &countingReader{r: cmd.stdin, n: &cmd.stdinBytes}
+	}
+	if countable(stdout) {
+		cmd.Stdout = &countingWriter{w: stdout, n: &cmd.stdoutBytes}
+	}
+	if stderr == stdout {
+		// os/exec shares a single pipe when both streams are the same
+		// writer, so the output can't be told apart. It's all counted as
+		// stdout.
+		cmd.Stderr = cmd.Stdout
+	} else if countable(stderr) {
+		cmd.Stderr = &countingWriter{w: stderr, n: &cmd.stderrBytes}
+	}
+	return func() {
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+	}
+}
+
+// restoreStdin undoes the wrapping of stdin by countStreams.
+func (cmd *Command) restoreStdin() {
+	if cmd.stdin != nil {
+		cmd.Stdin = cmd.stdin
+		cmd.stdin = nil
+	}
+}
+
+// countable reports whether input or output passed through the stream "s"
+// to a process can be counted.
+func countable(s any) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.(*os.File)
+	return !ok
+}
+
+// countingWriter adds the number of bytes written to "w" to "n".
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+// countingReader adds the number of bytes read from "r" to "n".
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n.Add(int64(n))
+	return n, err
+}
+
+// StdinBytesWritten returns the number of bytes of input written to the
+// command's stdin since it was last started. It is safe to call while the
+// command is running, and the count is final once Wait has returned.
+//
+// Input is only counted when Stdin is a reader that os/exec copies to the
+// process (e.g., BufStdin). When Stdin is nil or an *os.File, the process
+// reads it directly, and StdinBytesWritten returns 0.
+func (cmd *Command) StdinBytesWritten() int64 {
+	return cmd.stdinBytes.Load()
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// WithLogging returns a copy of the list of commands, where every command
+// writes a line to "w" when it starts and when it's done, e.g.,
+//
+//	START: sleep 1
+//	DONE: sleep 1 (1.002s, <nil>)
+//
+// Commands are described by their String method if they are a *Command,
+// and by their type otherwise. Lines from commands running concurrently
+// never interleave.
+func (cmds Commands) WithLogging(w io.Writer) Commands {
+	mu := new(sync.Mutex)
+	logged := make(Commands, len(cmds))
+	for i, c := range cmds {
+		logged[i] = &loggingCommander{cmd: c, w: w, mu: mu}
+	}
+	return logged
+}
+
+// loggingCommander logs the start and end of a command to "w", while holding
+// "mu".
+type loggingCommander struct {
+	cmd Commander
+	w   io.Writer
+	mu  *sync.Mutex
+}
+
+func (c *loggingCommander) Run() error {
+	return c.RunContext(context.Background())
+}
+
+func (c *loggingCommander) RunContext(ctx context.Context) error {
+	name := fmt.Sprintf("%T", c.cmd)
+	if cmd, ok := c.cmd.(*Command); ok {
+		name = cmd.String()
+	}
+
+	c.log("START: %s\n", name)
+	start := time.Now()
+	err := runContext(ctx, c.cmd)
+	c.log("DONE: %s (%s, %v)\n", name, humanDuration(time.Since(start)), err)
+	return err
+}
+
+func (c *loggingCommander) log(format string, args ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(c.w, format, args...)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"strings"
+	"time"
+)
+
+// MergeOutputs runs the commands concurrently and returns the lines they
+// wrote to stdout merged into a single stream ordered by time, along with the
+// errors of the commands as returned by RunMany. It is useful for merging
+// logs.
+//
+// The time of each line is found by "parse", which returns false if the line
+// has no time. Such lines (e.g., the continuation of a multi-line message)
+// stay right after the line that preceded them in the output of their
+// command. Lines from the same command are never reordered, and lines with
+// the same time are ordered by the position of their command in "cmds".
+func MergeOutputs(cmds []*Command,
+	parse func(line string) (time.Time, bool)) (string, []error) {
+
+	errs := NewCommands(cmds).RunMany(len(cmds))
+
+	type timedLine struct {
+		t    time.Time
+		line string
+	}
+	outputs := make([][]timedLine, len(cmds))
+	for i, cmd := range cmds {
+		out := strings.TrimSuffix(cmd.BufStdout.String(), "\n")
+		if out == "" {
+			continue
+		}
+		var last time.Time
+		for _, line := range strings.Split(out, "\n") {
+			if t, ok := parse(line); ok {
+				last = t
+			}
+			outputs[i] = append(outputs[i], timedLine{last, line})
+		}
+	}
+
+	var merged strings.Builder
+	for {
+		next := -1
+		for i, lines := range outputs {
+			if len(lines) == 0 {
+				continue
+			}
+			if next < 0 || lines[0].t.Before(outputs[next][0].t) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		merged.WriteString(outputs[next][0].line)
+		merged.WriteByte('\n')
+		outputs[next] = outputs[next][1:]
+	}
+	return merged.String(), errs
+}
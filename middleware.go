@@ -0,0 +1,29 @@
+package cmd
+
+// CommanderMiddleware decorates a Commander, e.g., to log it, time it or
+// retry it. It returns a Commander that usually runs "next" at some point.
+type CommanderMiddleware func(next Commander) Commander
+
+// Chain decorates "c" with each of "middlewares". The first middleware is
+// the outermost, so it runs first. e.g., Chain(c, a, b) is a(b(c)).
+func Chain(c Commander, middlewares ...CommanderMiddleware) Commander {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		c = middlewares[i](c)
+	}
+	return c
+}
+
+// Wrap decorates the command with "middleware". It is the same as
+// Chain(cmd, middleware).
+//
+// Note that the decorated command is a Commander rather than a *Command, so
+// it should be configured before it is wrapped.
+func (cmd *Command) Wrap(middleware CommanderMiddleware) Commander {
+	return Chain(cmd, middleware)
+}
+
+// WrapAll decorates the command with each of "middlewares". It is the same
+// as Chain(cmd, middlewares...).
+func (cmd *Command) WrapAll(middlewares ...CommanderMiddleware) Commander {
+	return Chain(cmd, middlewares...)
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os/exec"
+	"strings"
+)
+
+// MultiError is the error returned by RunManyError when at least one command
+// fails. It records which commands failed and how, so that callers can act
+// on the failures (e.g., retry them) without parsing error messages.
+//
+// The errors of the failed commands can be matched with errors.Is and
+// errors.As.
+type MultiError struct {
+	// Errs is the list of errors of every command in the batch, aligned with
+	// the list of commands, as returned by RunMany.
+	Errs []error
+
+	exitCodes map[int]int
+}
+
+// RunManyError is like RunMany, except it returns a single error. The error
+// is nil if every command succeeded, and is a *MultiError otherwise.
+func (cmds Commands) RunManyError(workers int) error {
+	errs := cmds.RunMany(workers)
+	if me := newMultiError(cmds, errs); me != nil {
+		return me
+	}
+	return nil
+}
+
+// newMultiError returns a MultiError for the errors of "cmds", or nil if
+// there are none.
+func newMultiError(cmds Commands, errs []error) *MultiError {
+	me := &MultiError{Errs: errs, exitCodes: make(map[int]int)}
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if code, ok := exitCode(cmds[i], err); ok {
+			me.exitCodes[i] = code
+		}
+	}
+	if len(me.FailedIndices()) == 0 {
+		return nil
+	}
+	return me
+}
+
+// exitCode returns the exit code of a command that has been run, if it
+// exited normally.
+func exitCode(c Commander, err error) (int, bool) {
+	var ecmd *exec.Cmd
+	switch c := c.(type) {
+	case *Command:
+		ecmd = c.Cmd
+	case *exec.Cmd:
+		ecmd = c
+	}
+	if ecmd != nil && ecmd.ProcessState != nil {
+		code := ecmd.ProcessState.ExitCode()
+		return code, code >= 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
+
+// FailedIndices returns the indices of the commands that failed, in
+// ascending order.
+func (m *MultiError) FailedIndices() []int {
+	var failed []int
+	for i, err := range m.Errs {
+		if err != nil {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// ExitCodes returns the exit code of every command that failed, by index.
+// Commands that failed without exiting normally (e.g., because they
+// couldn't be started, or were killed by a signal) have no exit code.
+func (m *MultiError) ExitCodes() map[int]int {
+	return maps.Clone(m.exitCodes)
+}
+
+func (m *MultiError) Error() string {
+	failed := m.FailedIndices()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d of %d commands failed:", len(failed), len(m.Errs))
+	for _, i := range failed {
+		fmt.Fprintf(&b, "\n[%d] %s", i, m.Errs[i])
+	}
+	return b.String()
+}
+
+// Unwrap returns the errors of the commands that failed.
+func (m *MultiError) Unwrap() []error {
+	var errs []error
+	for _, err := range m.Errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
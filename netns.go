@@ -0,0 +1,18 @@
+package cmd
+
+import "strings"
+
+// WithNetworkNamespace configures the command to run inside the network
+// namespace at nsPath. If nsPath doesn't contain a slash, then it is
+// interpreted as the name of a namespace created with "ip netns add", and is
+// looked up in /var/run/netns.
+//
+// Network namespaces are only supported on Linux. On other platforms, Start
+// (and therefore Run) will return ErrUnsupported.
+func (cmd *Command) WithNetworkNamespace(nsPath string) *Command {
+	if !strings.Contains(nsPath, "/") {
+		nsPath = "/var/run/netns/" + nsPath
+	}
+	cmd.netns = nsPath
+	return cmd
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// startInNetns starts the command from an OS thread that has been moved into
+// the command's network namespace. A forked child inherits the namespaces of
+// the thread that forked it, so the thread is moved back to its original
+// namespace once the process has started.
+func (cmd *Command) startInNetns() error {
+	target, err := os.Open(cmd.netns)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		orig, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net",
+			syscall.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			errc <- err
+			return
+		}
+		defer orig.Close()
+
+		if err := setns(target); err != nil {
+			runtime.UnlockOSThread()
+			errc <- fmt.Errorf("Could not enter network namespace '%s': %w",
+				cmd.netns, err)
+			return
+		}
+		errc <- cmd.Cmd.Start()
+
+		// If we can't get back to the original namespace, then the thread
+		// stays locked. The runtime terminates it when this goroutine exits,
+		// so that no other goroutine is scheduled in the wrong namespace.
+		if setns(orig) == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+	return <-errc
+}
+
+// setns moves the calling thread into the network namespace referred to by f.
+func setns(f *os.File) error {
+	_, _, errno := syscall.RawSyscall(sysSetns, f.Fd(),
+		syscall.CLONE_NEWNET, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package cmd
+
+func (cmd *Command) startInNetns() error {
+	return ErrUnsupported
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"io"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Option configures a command created by NewWithOptions.
+type Option func(*Command)
+
+// NewWithOptions is like New, except the command is configured by applying
+// each of "opts" in order. e.g.,
+//
+//	cmd := NewWithOptions("make",
+//		WithArgs("-j", "4"), Dir("build"), Timeout(time.Minute))
+func NewWithOptions(name string, opts ...Option) *Command {
+	cmd := New(name)
+	for _, opt := range opts {
+		opt(cmd)
+	}
+	return cmd
+}
+
+// WithArgs appends "arg" to the arguments of the command.
+func WithArgs(arg ...string) Option {
+	return func(cmd *Command) {
+		cmd.Args = append(cmd.Args, arg...)
+	}
+}
+
+// Dir sets the working directory of the command.
+func Dir(dir string) Option {
+	return func(cmd *Command) {
+		cmd.WithWorkDir(dir)
+	}
+}
+
+// Env adds the variables in "env" to the environment of the command, as
+// with AddEnv. They are added in order of their names.
+func Env(env map[string]string) Option {
+	return func(cmd *Command) {
+		for _, key := range slices.Sorted(maps.Keys(env)) {
+			cmd.AddEnv(key, env[key])
+		}
+	}
+}
+
+// Timeout sets the Timeout of the command.
+func Timeout(d time.Duration) Option {
+	return func(cmd *Command) {
+		cmd.Timeout = d
+	}
+}
+
+// Stdin sets the stdin of the command to "r", in place of BufStdin.
+func Stdin(r io.Reader) Option {
+	return func(cmd *Command) {
+		cmd.Stdin = r
+	}
+}
+
+// OnLine calls "fn" with every line the command writes to stdout, as it is
+// written and without its line terminator. The output is still written to
+// BufStdout as usual. A final line that isn't terminated is passed to "fn"
+// once the command has been waited on.
+func OnLine(fn func(line string)) Option {
+	return func(cmd *Command) {
+		lw := &lineWriter{fn: fn}
+		cmd.Stdout = teeWriter(cmd.Stdout, lw)
+		cmd.lineWriters = append(cmd.lineWriters, lw)
+	}
+}
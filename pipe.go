@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync/atomic"
+)
+
+// Pipe connects the command's stdout and stderr to pipes, and returns the
+// read end of each along with functions to start the command and wait for
+// it. Output is not written to BufStdout or BufStderr.
+//
+// Consumers of the readers may be set up before the command is started.
+// "wait" must only be called after both readers have been read until EOF,
+// since it closes them. Both readers should be read concurrently: a command
+// that fills one pipe while the other is not being read will block forever.
+func (cmd *Command) Pipe() (stdout io.ReadCloser, stderr io.ReadCloser,
+	start func() error, wait func() error) {
+
+	cmd.Stdout, cmd.Stderr = nil, nil
+	stdout, errOut := cmd.Cmd.StdoutPipe()
+	stderr, errErr := cmd.Cmd.StderrPipe()
+	start = func() error {
+		for _, err := range []error{errOut, errErr} {
+			if err != nil {
+				return fmt.Errorf("Error starting %s: %w.",
+					cmd.describe(), err)
+			}
+		}
+		if err := cmd.preRun(); err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("Error starting %s: %w.", cmd.describe(), err)
+		}
+		return nil
+	}
+	return stdout, stderr, start, cmd.Wait
+}
+
+// RunWithReader starts the command and returns a reader that yields its
+// stdout as it's written, along with a function that waits for the command
+// to finish. The output is also written to BufStdout as usual, so that all
+// of it is available once the command has finished, regardless of how much
+// was read. The reader returns EOF once the command has exited.
+//
+// The command blocks while its output isn't being read, so the reader should
+// be read until EOF before calling "wait". If "wait" is called first, then
+// the reader is closed and the rest of the output only goes to BufStdout.
+// If the command couldn't be started, then the reader and "wait" both return
+// the error.
+func (cmd *Command) RunWithReader() (io.Reader, func() error) {
+	pr, pw := io.Pipe()
+	cmd.Stdout = teeWriter(cmd.Stdout, &bestEffortWriter{w: pw})
+	err := cmd.preRun()
+	if err == nil {
+		if err = cmd.Start(); err != nil {
+			err = fmt.Errorf("Error starting %s: %w.", cmd.describe(), err)
+		}
+	}
+	if err != nil {
+		pw.CloseWithError(err)
+		return pr, func() error { return err }
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		done <- err
+	}()
+	return pr, func() error {
+		pr.Close()
+		return <-done
+	}
+}
+
+// WriteTo runs the command with its stdout written directly to "w" instead
+// of BufStdout, and returns the number of bytes written along with the error
+// returned by Run. Stderr is still captured, so that it is reported if the
+// command fails. This is useful for commands with a lot of output, e.g.,
+// downloading a file to disk. It also makes *Command an io.WriterTo.
+//
+// Once the command has finished, its Stdout is "w".
+func (cmd *Command) WriteTo(w io.Writer) (int64, error) {
+	var n atomic.Int64
+	cmd.Stdout = &countingWriter{w: w, n: &n}
+	err := cmd.Run()
+	cmd.Stdout = w
+	return n.Load(), err
+}
+
+// bestEffortWriter writes to "w" until a write fails, after which writes are
+// dropped. It never returns an error, so that it can be used with
+// io.MultiWriter without affecting the other writers.
+type bestEffortWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (w *bestEffortWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		_, w.err = w.w.Write(p)
+	}
+	return len(p), nil
+}
+
+// StdinWriter returns a writer connected to the command's stdin, so that
+// input can be written to the command incrementally while it runs. Closing
+// the writer sends EOF to the command. BufStdin is no longer used. It must
+// be called before the command is started.
+//
+// Writes block when the pipe is full, until the command reads from it. With
+// the default stdout and stderr buffers, the command's output is always
+// consumed. But if the output is read from pipes (e.g., with Pipe), then
+// they must be read concurrently with writing to stdin, or else the command
+// may block forever writing its output.
+func (cmd *Command) StdinWriter() (io.WriteCloser, error) {
+	if cmd.Process != nil {
+		return nil, ErrAlreadyStarted
+	}
+	cmd.Stdin = nil
+	w, err := cmd.Cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("Error starting %s: %w.", cmd.describe(), err)
+	}
+	return w, nil
+}
+
+// StdinFromCommand pipes the stdout of "src" to the stdin of the command,
+// like "src | cmd" in a shell. "src" is started right after the command is
+// started, and Wait (or Run) waits for both to finish.
+//
+// The error returned by Wait is the command's error if it failed, and
+// otherwise the error of "src". If the command exits before "src" has
+// finished (e.g., without reading all of its input), then "src" is stopped
+// and its error is ignored, like a shell does.
+//
+// "src" must be a *Command or an *exec.Cmd, since its stdout must be
+// redirected. Otherwise, Start (and therefore Run) returns an error.
+func (cmd *Command) StdinFromCommand(src Commander) *Command {
+	pr, pw := io.Pipe()
+	switch src := src.(type) {
+	case *Command:
+		src.Stdout = pw
+	case *exec.Cmd:
+		src.Stdout = pw
+	default:
+		cmd.configErr = fmt.Errorf("can't pipe the output of %T", src)
+		return cmd
+	}
+	cmd.Stdin = pr
+	cmd.source = &pipeSource{src: src, r: pr, w: pw}
+	return cmd
+}
+
+// pipeSource is a command whose output is piped to the stdin of another
+// command.
+type pipeSource struct {
+	src  Commander
+	r    *io.PipeReader
+	w    *io.PipeWriter
+	done chan error
+	// finished is set once the source command has finished, before the
+	// reading command can see EOF.
+	finished atomic.Bool
+}
+
+// start runs the source command in the background.
+func (p *pipeSource) start() {
+	p.done = make(chan error, 1)
+	go func() {
+		err := p.src.Run()
+		p.finished.Store(true)
+		p.w.Close()
+		p.done <- err
+	}()
+}
+
+// wait waits for the source command to finish, given the error returned by
+// the command reading from it.
+func (p *pipeSource) wait(err error) error {
+	finished := p.finished.Load()
+
+	// If the reading command exited early, then the source command may be
+	// blocked writing to the pipe. Closing it makes the source command fail.
+	p.r.Close()
+	srcErr := <-p.done
+	if err == nil && finished {
+		return srcErr
+	}
+	return err
+}
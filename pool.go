@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
 	"sync"
+	"time"
 )
 
 // Commands allows any kind of command with a "Run() error" method to be used
@@ -12,6 +17,42 @@ type Commander interface {
 	Run() error
 }
 
+// ContextCommander is a Commander that can also be run with a context, such
+// that the command is stopped when the context is done. The pool uses
+// RunContext instead of Run for any command that satisfies this interface.
+type ContextCommander interface {
+	Commander
+	RunContext(ctx context.Context) error
+}
+
+// stdinMu is held while a command that reads from stdin is run by a pool.
+var stdinMu sync.Mutex
+
+// runContext runs "c" with RunContext if it's a ContextCommander, and with
+// Run otherwise. Every command run by a pool is run with runContext.
+//
+// If "c" is a *Command whose ReadsStdin is set, then its stdin is set to the
+// stdin of the current process, and no other such command is run at the same
+// time.
+func runContext(ctx context.Context, c Commander) error {
+	if cmd, ok := c.(*Command); ok && cmd.ReadsStdin {
+		stdinMu.Lock()
+		defer stdinMu.Unlock()
+		cmd.Stdin = os.Stdin
+	}
+	if cc, ok := c.(ContextCommander); ok {
+		return cc.RunContext(ctx)
+	}
+	return c.Run()
+}
+
+// commanderFunc adapts a function to the Commander interface.
+type commanderFunc func() error
+
+func (f commanderFunc) Run() error {
+	return f()
+}
+
 // Commands is a list of values that implement the Commander interface.
 // This is used as the list of commands to be executed in a pool.
 type Commands []Commander
@@ -36,16 +77,52 @@ func NewCmds(cmds []*exec.Cmd) Commands {
 	return lst
 }
 
+// ExecCmds is like NewCmds, except the commands are given as arguments
+// rather than as a list. e.g.,
+//
+//	errs := ExecCmds(exec.Command("true"), exec.Command("true")).RunMany(0)
+func ExecCmds(cmds ...*exec.Cmd) Commands {
+	return NewCmds(cmds)
+}
+
+// NewCommandsFromFuncs is a convenience function for creating a list of
+// Commanders from a list of functions, where running each Commander calls
+// its function. This is an intentional use of the Commander interface: it
+// makes RunMany a general purpose way to run any work in parallel, not just
+// external commands.
+func NewCommandsFromFuncs(fns []func() error) Commands {
+	lst := make([]Commander, len(fns))
+	for i, fn := range fns {
+		lst[i] = commanderFunc(fn)
+	}
+	return lst
+}
+
 // RunMany creates a pool with a number of workers specified by "workers".
 // If "workers" is less than 1, then the value of GOMAXPROCS is used.
 // Every command in "cmds" is executed once by a single worker.
-// A list of errors corresponding to the list of 'cmds' is returned, where the 
+// A list of errors corresponding to the list of 'cmds' is returned, where the
 // length of the list of errors is always equivalent to the length of 'cmds'.
 //
 // A convenient way to use this method, given a list of *Command:
 //
 //	errs := NewCommands(commands).RunMany(0)
 func (cmds Commands) RunMany(workers int) []error {
+	return cmds.RunManyContext(context.Background(), workers)
+}
+
+// RunManyContext is like RunMany, except no more commands are started once
+// "ctx" is done. Commands that are already running are cancelled if they
+// implement ContextCommander. (*Command implements ContextCommander.)
+//
+// The error of every command that wasn't started wraps ErrSkipped. The error
+// of every command that wasn't started or that failed after "ctx" was done
+// wraps ErrBatchTimeout if the deadline of "ctx" was exceeded, and
+// ErrCancelled otherwise.
+func (cmds Commands) RunManyContext(ctx context.Context, workers int) []error {
+	if len(cmds) == 0 {
+		return []error{}
+	}
 	if workers < 1 {
 		workers = runtime.GOMAXPROCS(0)
 	}
@@ -59,17 +136,510 @@ func (cmds Commands) RunMany(workers int) []error {
 			defer wg.Done()
 
 			for job := range jobs {
-				if err := cmds[job].Run(); err != nil {
+				if ctx.Err() != nil {
+					errs[job] = skippedErr(ctx)
+					continue
+				}
+				if err := runContext(ctx, cmds[job]); err != nil {
+					if ctx.Err() != nil {
+						err = fmt.Errorf("%w: %w", batchErr(ctx), err)
+					}
 					errs[job] = err
 				}
 			}
 		}()
 	}
+dispatch:
 	for i := range cmds {
-		jobs <- i
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			for j := i; j < len(cmds); j++ {
+				errs[j] = skippedErr(ctx)
+			}
+			break dispatch
+		}
 	}
 	close(jobs)
 
 	wg.Wait()
 	return errs
 }
+
+// RunManyResults is like RunMany, except a Result is returned for every
+// command instead of just its error.
+func (cmds Commands) RunManyResults(workers int) []Result {
+	results := make([]Result, len(cmds))
+	for i, err := range cmds.RunMany(workers) {
+		results[i] = newResult(i, cmds[i], err)
+	}
+	return results
+}
+
+// RunManyPartition is like RunMany, except it returns the indices of the
+// commands that succeeded and the indices of the commands that failed, in
+// ascending order.
+func (cmds Commands) RunManyPartition(workers int) (succeeded, failed []int) {
+	for i, err := range cmds.RunMany(workers) {
+		if err == nil {
+			succeeded = append(succeeded, i)
+		} else {
+			failed = append(failed, i)
+		}
+	}
+	return succeeded, failed
+}
+
+// RunManyWithDeadline is like RunManyContext, where the context expires at
+// "deadline".
+//
+// Commands that haven't been started by the deadline are never started, and
+// their error wraps ErrSkipped and ErrBatchTimeout. Commands that are still
+// running when the deadline passes are cancelled only if they implement
+// ContextCommander (e.g., *Command, which kills its process). Any other
+// command is left to run to completion, so this function may return after
+// the deadline has passed.
+func (cmds Commands) RunManyWithDeadline(deadline time.Time,
+	workers int) []error {
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	return cmds.RunManyContext(ctx, workers)
+}
+
+// RunManyCancelable is like RunManyContext, except the batch is run in the
+// background and is cancelled by calling the function returned, rather than
+// with a context. This is convenient when the batch is cancelled from
+// somewhere that a context can't easily reach, e.g., a signal handler.
+//
+// The list of errors is sent on the channel returned once every command has
+// finished, as described for RunManyContext. Calling "cancel" more than once,
+// or after the batch has finished, has no effect.
+func (cmds Commands) RunManyCancelable(
+	workers int) (result <-chan []error, cancel func()) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan []error, 1)
+	go func() {
+		defer cancel()
+		errs <- cmds.RunManyContext(ctx, workers)
+	}()
+	return errs, cancel
+}
+
+// GroupedRunMany runs every group of commands at the same time, where each
+// group has its own pool with a number of workers given by "workers" for the
+// group's name. If a group has no entry in "workers", or the entry is less
+// than 1, then the value of GOMAXPROCS is used. Since the pools are
+// separate, a group of slow commands doesn't delay the commands of another
+// group. (e.g., I/O bound and CPU bound commands can be given differently
+// sized pools.)
+//
+// The errors of each group are returned by group name, as returned by
+// RunManyContext. GroupedRunMany returns once every group has finished.
+func GroupedRunMany(ctx context.Context, groups map[string]Commands,
+	workers map[string]int) map[string][]error {
+
+	mu := new(sync.Mutex)
+	errs := make(map[string][]error, len(groups))
+	wg := new(sync.WaitGroup)
+	for name, cmds := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			groupErrs := cmds.RunManyContext(ctx, workers[name])
+			mu.Lock()
+			errs[name] = groupErrs
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+var (
+	// ErrSkipped is wrapped by the error of a command in a batch that was
+	// never started.
+	ErrSkipped = errors.New("command skipped")
+
+	// ErrCancelled is wrapped by the error of a command in a batch that was
+	// cancelled.
+	ErrCancelled = errors.New("batch cancelled")
+
+	// ErrBatchTimeout is wrapped by the error of a command in a batch whose
+	// deadline was exceeded.
+	ErrBatchTimeout = errors.New("batch timed out")
+)
+
+// batchErr returns either ErrBatchTimeout or ErrCancelled, depending on why
+// "ctx" is done.
+func batchErr(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrBatchTimeout
+	}
+	return ErrCancelled
+}
+
+// skippedErr returns the error of a command that wasn't started because
+// "ctx" is done.
+func skippedErr(ctx context.Context) error {
+	return fmt.Errorf("%w: %w: %w", ErrSkipped, batchErr(ctx), ctx.Err())
+}
+
+// RetryFailed runs again every command whose error in "prev" is not nil,
+// where "prev" is the list of errors returned by a previous run of "cmds"
+// (e.g., from RunMany). Every *Command is reset with (*Command).Reset before
+// it is run again. Other kinds of commands are run as is.
+//
+// The list of errors returned is aligned with "cmds", like the list returned
+// by RunMany. Commands that succeeded previously are not run, and their
+// error is nil.
+func (cmds Commands) RetryFailed(prev []error, workers int) []error {
+	var failed []int
+	var retry Commands
+	for i, err := range prev {
+		if err == nil || i >= len(cmds) {
+			continue
+		}
+		if cmd, ok := cmds[i].(*Command); ok {
+			cmd.Reset()
+		}
+		failed = append(failed, i)
+		retry = append(retry, cmds[i])
+	}
+
+	errs := make([]error, len(cmds))
+	for j, err := range retry.RunMany(workers) {
+		errs[failed[j]] = err
+	}
+	return errs
+}
+
+// LimitedCommands is a list of commands that never runs more than Max
+// commands at the same time, regardless of the number of workers requested.
+// If Max is less than 1, then there is no limit.
+//
+// Only RunMany and RunManyContext are provided, since they are the only ways
+// of running the commands that apply the limit. The other ways of running a
+// batch of commands (e.g., RunManyPartition) can be used with the limit by
+// passing LimitedCommands.Workers as their number of workers.
+type LimitedCommands struct {
+	Commands Commands
+	Max      int
+}
+
+// RunMany is like (Commands).RunMany, except the number of workers is
+// capped at Max.
+func (cmds LimitedCommands) RunMany(workers int) []error {
+	return cmds.Commands.RunMany(cmds.Workers(workers))
+}
+
+// RunManyContext is like (Commands).RunManyContext, except the number of
+// workers is capped at Max.
+func (cmds LimitedCommands) RunManyContext(ctx context.Context,
+	workers int) []error {
+
+	return cmds.Commands.RunManyContext(ctx, cmds.Workers(workers))
+}
+
+// Workers returns the number of workers that running the commands with
+// "workers" workers actually uses: GOMAXPROCS if "workers" is less than 1,
+// capped at Max.
+func (cmds LimitedCommands) Workers(workers int) int {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if cmds.Max > 0 && workers > cmds.Max {
+		workers = cmds.Max
+	}
+	return workers
+}
+
+// Result is the outcome of running a single command in a pool.
+type Result struct {
+	// Index is the position of the command in the list of commands it was
+	// run with, or the order in which it was submitted to a Pool.
+	Index int
+	Cmd   Commander
+	Err   error
+
+	// Meta is the Meta field of the command, if it is a *Command.
+	Meta map[string]any
+
+	// StdoutBytes and StderrBytes are the number of bytes the command wrote
+	// to stdout and stderr, if it is a *Command. They count all output,
+	// even output that was dropped (e.g., by RunManyMaxOutput) or discarded
+	// with io.Discard. Output written directly to an *os.File isn't
+	// counted, and if stdout and stderr are the same writer, then all
+	// output is counted in StdoutBytes.
+	StdoutBytes, StderrBytes int64
+}
+
+// newResult returns the result of the command at index "i".
+func newResult(i int, c Commander, err error) Result {
+	r := Result{Index: i, Cmd: c, Err: err}
+	if cmd, ok := c.(*Command); ok {
+		r.Meta = cmd.Meta
+		r.StdoutBytes = cmd.stdoutBytes.Load()
+		r.StderrBytes = cmd.stderrBytes.Load()
+	}
+	return r
+}
+
+// ErrPoolClosed is the error of any command submitted to a Pool after it
+// has been closed.
+var ErrPoolClosed = errors.New("pool is closed")
+
+// workerPool is what Pool and ElasticPool have in common: the queue of
+// submitted commands, and the workers' loop that runs them. The two differ in
+// how workers are started and which command a worker takes next.
+type workerPool struct {
+	mu sync.Mutex
+	// ready is signaled when a command is queued or the pool is closed.
+	ready *sync.Cond
+	// idle is broadcast when the number of pending commands reaches zero.
+	idle    *sync.Cond
+	queue   []*Future
+	pending int
+	next    int
+	closed  bool
+	workers sync.WaitGroup
+}
+
+func (p *workerPool) init() {
+	p.ready = sync.NewCond(&p.mu)
+	p.idle = sync.NewCond(&p.mu)
+}
+
+// newFuture returns a Future for "cmd". The pool's lock must be held.
+func (p *workerPool) newFuture(cmd Commander) *Future {
+	f := &Future{
+		result: newResult(p.next, cmd, nil),
+		done:   make(chan struct{}),
+	}
+	p.next++
+	return f
+}
+
+// submit queues "cmd" to be run by one of the pool's workers, and then calls
+// "queued" with the pool's lock held, to wake up or start a worker. If the
+// pool has been closed, then "cmd" is not run and the Future's error is
+// ErrPoolClosed.
+func (p *workerPool) submit(cmd Commander, queued func()) *Future {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f := p.newFuture(cmd)
+	if p.closed {
+		f.result.Err = ErrPoolClosed
+		close(f.done)
+		return f
+	}
+	p.pending++
+	p.queue = append(p.queue, f)
+	queued()
+	return f
+}
+
+// Drain blocks until every command submitted to the pool so far has
+// finished.
+func (p *workerPool) Drain() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.pending > 0 {
+		p.idle.Wait()
+	}
+}
+
+// Close waits for every submitted command to finish and then stops the
+// pool's workers. Commands submitted after Close is called are not run.
+func (p *workerPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.ready.Broadcast()
+	p.mu.Unlock()
+
+	p.workers.Wait()
+}
+
+// serve is the loop of a worker, which runs the commands returned by "take"
+// until it returns nil. "take" is called with the pool's lock held, and may
+// wait on "ready" for a command.
+func (p *workerPool) serve(take func() *Future) {
+	defer p.workers.Done()
+
+	for {
+		p.mu.Lock()
+		f := take()
+		p.mu.Unlock()
+		if f == nil {
+			return
+		}
+
+		err := runContext(context.Background(), f.result.Cmd)
+		f.result = newResult(f.result.Index, f.result.Cmd, err)
+		close(f.done)
+
+		p.mu.Lock()
+		p.pending--
+		if p.pending == 0 {
+			p.idle.Broadcast()
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Pool is a persistent pool of workers that commands can be submitted to at
+// any time. Unlike RunMany, the list of commands doesn't need to be known up
+// front.
+//
+// A Pool must be created with NewPool, and should be closed with Close once
+// no more commands will be submitted.
+type Pool struct {
+	workerPool
+	// locals holds the commands pushed to each worker's local queue.
+	locals []*WorkQueue
+	// live is the number of workers that haven't stopped.
+	live int
+}
+
+// Future is a command that has been submitted to a Pool. It can be used to
+// wait for that command alone to finish.
+type Future struct {
+	result Result
+	done   chan struct{}
+}
+
+// WorkQueue is the local queue of a single worker in a Pool. See
+// (*Pool).RegisterWorkerLocalQueue.
+type WorkQueue struct {
+	p    *Pool
+	jobs []*Future
+}
+
+// NewPool creates a new pool and starts its workers. If "workers" is less
+// than 1, then the value of GOMAXPROCS is used.
+func NewPool(workers int) *Pool {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := &Pool{}
+	p.init()
+	p.locals = make([]*WorkQueue, workers)
+	p.live = workers
+	for i := 0; i < workers; i++ {
+		p.locals[i] = &WorkQueue{p: p}
+		p.workers.Add(1)
+		go p.work(i)
+	}
+	return p
+}
+
+// Submit queues "cmd" to be run by one of the pool's workers. Submit never
+// blocks. The Future returned can be used to wait for "cmd" to finish.
+//
+// If the pool has been closed, then "cmd" is not run and the Future's error
+// is ErrPoolClosed.
+func (p *Pool) Submit(cmd Commander) *Future {
+	return p.submit(cmd, p.ready.Signal)
+}
+
+// RegisterWorkerLocalQueue returns the local queue of the worker with the
+// given id, where workers are numbered from 0. It returns nil if there is no
+// such worker.
+//
+// This is an experimental extension for commands that spawn sub-work. A
+// command can push sub-commands to a local queue, and they are run by the
+// queue's worker once it is free, most recently pushed first. Workers that
+// are idle steal from the other end of other workers' local queues, oldest
+// first, so that sub-work is spread out when there is no other work to do.
+// A worker prefers its local queue over submitted commands, and submitted
+// commands over stealing.
+//
+// Note that all queues are guarded by the same lock as the rest of the pool,
+// rather than being lock-free Chase-Lev deques. The benefit of local queues
+// is the order in which sub-work is run, which keeps related work together,
+// and not reduced contention. Callers running many small commands through
+// a single channel-based RunMany may see better throughput.
+func (p *Pool) RegisterWorkerLocalQueue(workerID int) *WorkQueue {
+	if workerID < 0 || workerID >= len(p.locals) {
+		return nil
+	}
+	return p.locals[workerID]
+}
+
+// Push adds "cmd" to the local queue. Push never blocks. The Future returned
+// can be used to wait for "cmd" to finish.
+//
+// Unlike Submit, commands may be pushed after the pool has been closed, so
+// that commands running at the time can still push sub-work. Close waits for
+// all of it to finish. Once every worker has stopped, though, nothing is left
+// to run pushed commands, so "cmd" is not run and the Future's error is
+// ErrPoolClosed.
+func (q *WorkQueue) Push(cmd Commander) *Future {
+	q.p.mu.Lock()
+	defer q.p.mu.Unlock()
+
+	f := q.p.newFuture(cmd)
+	if q.p.live == 0 {
+		f.result.Err = ErrPoolClosed
+		close(f.done)
+		return f
+	}
+	q.p.pending++
+	q.jobs = append(q.jobs, f)
+	q.p.ready.Signal()
+	return f
+}
+
+func (p *Pool) work(id int) {
+	p.serve(func() *Future {
+		f := p.take(id)
+		for f == nil && !p.closed {
+			p.ready.Wait()
+			f = p.take(id)
+		}
+		if f == nil {
+			p.live--
+		}
+		return f
+	})
+}
+
+// take removes and returns the next command for the worker with the given
+// id to run, or nil if there are none. The pool's lock must be held.
+func (p *Pool) take(id int) *Future {
+	if local := p.locals[id]; len(local.jobs) > 0 {
+		f := local.jobs[len(local.jobs)-1]
+		local.jobs = local.jobs[:len(local.jobs)-1]
+		return f
+	}
+	if len(p.queue) > 0 {
+		f := p.queue[0]
+		p.queue = p.queue[1:]
+		return f
+	}
+	for i := 1; i < len(p.locals); i++ {
+		victim := p.locals[(id+i)%len(p.locals)]
+		if len(victim.jobs) > 0 {
+			f := victim.jobs[0]
+			victim.jobs = victim.jobs[1:]
+			return f
+		}
+	}
+	return nil
+}
+
+// Done returns a channel that is closed once the command has finished.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the command has finished, and returns its result along
+// with the error it returned.
+func (f *Future) Wait() (Result, error) {
+	<-f.done
+	return f.result, f.result.Err
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// barWidth is the number of characters inside the progress bar rendered by
+// RunManyBar.
+const barWidth = 20
+
+// RunManyBar is like RunMany, except a progress bar is rendered to "w" as
+// commands finish, e.g.,
+//
+//	[==========          ] 50% (100/200)
+//
+// If "w" is a terminal, then the bar is redrawn in place on a single line.
+// Otherwise, a line with the percentage is written every time another 10%
+// of the commands have finished. Either way, the last line written shows
+// 100% and ends with a new line.
+func (cmds Commands) RunManyBar(workers int, w io.Writer) []error {
+	tty := isTerminal(w)
+	lastDecile := -1
+	render := func(done, all int) {
+		pct := 100
+		if all > 0 {
+			pct = done * 100 / all
+		}
+		if tty {
+			fill := pct * barWidth / 100
+			fmt.Fprintf(w, "\r[%s%s] %d%% (%d/%d)",
+				strings.Repeat("=", fill), strings.Repeat(" ", barWidth-fill),
+				pct, done, all)
+			return
+		}
+		if decile := pct / 10; decile > lastDecile {
+			lastDecile = decile
+			fmt.Fprintf(w, "%d%% (%d/%d)\n", pct, done, all)
+		}
+	}
+
+	errs := cmds.RunManyWithProgress(workers, render)
+	if len(cmds) == 0 {
+		render(0, 0)
+	}
+	if tty {
+		fmt.Fprintln(w)
+	}
+	return errs
+}
+
+// RunManyWithProgress is like RunMany, except "progress" is called every time
+// a command finishes with the number of commands that have finished so far
+// (starting at 1) and the total number of commands. Calls to "progress" are
+// serialized, so it doesn't need any synchronization of its own (e.g., to
+// draw a progress bar), but the commands wait for it to return.
+func (cmds Commands) RunManyWithProgress(workers int,
+	progress func(done, all int)) []error {
+
+	var mu sync.Mutex
+	done := 0
+	wrapped := make(Commands, len(cmds))
+	for i, c := range cmds {
+		wrapped[i] = commanderFunc(func() error {
+			err := runContext(context.Background(), c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			done++
+			progress(done, len(cmds))
+			return err
+		})
+	}
+	return wrapped.RunMany(workers)
+}
+
+// isTerminal returns true if "w" is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,71 @@
+//go:build linux || darwin
+
+package cmd
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// RunPTY runs the command with its stdin, stdout and stderr attached to a
+// new pseudo-terminal, and returns everything the command wrote to the
+// terminal. The output is also written to BufStdout. This is useful for
+// capturing the output of programs that behave differently when they are
+// run interactively (e.g., with colors or progress bars).
+//
+// Since stdout and stderr are the same terminal, their output can't be
+// distinguished. No input is written to the terminal. See WithTTY.
+//
+// RunPTY is only supported on Linux and macOS. On other platforms,
+// ErrUnsupported is returned.
+func (cmd *Command) RunPTY() (string, error) {
+	if _, err := cmd.WithTTY(); err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("Error starting %s: %w.", cmd.describe(), err)
+	}
+	err := cmd.Wait()
+	return cmd.BufStdout.String(), err
+}
+
+// WithTTY attaches the command's stdin, stdout and stderr to a new
+// pseudo-terminal, so that it behaves as if it were run interactively (e.g.,
+// programs that check whether their output is a terminal). Everything the
+// command writes to the terminal is written to BufStdout, so stdout and stderr
+// can't be distinguished. No input is written to the terminal. It must be
+// called before the command is started.
+//
+// The output is complete once Wait (or Run) returns. Note that Wait also
+// waits for any processes started by the command that still have the
+// terminal open.
+//
+// The terminal is only used for the next run of the command. Once the
+// command has started, its stdin, stdout, stderr and SysProcAttr are
+// restored, and Reset doesn't attach a new terminal.
+//
+// WithTTY is only supported on Linux and macOS. On other platforms,
+// ErrUnsupported is returned.
+func (cmd *Command) WithTTY() (*Command, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return nil, fmt.Errorf("Error opening a pseudo-terminal: %w.", err)
+	}
+	stdin, stdout, stderr := cmd.Stdin, cmd.Stdout, cmd.Stderr
+	attr := cmd.SysProcAttr
+	detach := func() {
+		slave.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+		cmd.SysProcAttr = attr
+	}
+	cmd.tty = newTTY(master, detach, cmd.BufStdout)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+	cmd.SysProcAttr = new(syscall.SysProcAttr)
+	if attr != nil {
+		*cmd.SysProcAttr = *attr
+	}
+	cmd.SysProcAttr.Setsid = true
+	cmd.SysProcAttr.Setctty = true
+	cmd.SysProcAttr.Ctty = 0
+	return cmd, nil
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY allocates a new pseudo-terminal and returns both of its ends.
+func openPTY() (master, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := ioctl(master, syscall.TIOCPTYGRANT, 0); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	if err := ioctl(master, syscall.TIOCPTYUNLK, 0); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	buf := make([]byte, 128)
+	if err := ioctl(master, syscall.TIOCPTYGNAME,
+		uintptr(unsafe.Pointer(&buf[0]))); err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	name := string(buf[:bytes.IndexByte(buf, 0)])
+	slave, err = os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+func ioctl(f *os.File, req, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
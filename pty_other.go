@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package cmd
+
+// RunPTY is only supported on Linux and macOS.
+func (cmd *Command) RunPTY() (string, error) {
+	return "", ErrUnsupported
+}
+
+// WithTTY is only supported on Linux and macOS.
+func (cmd *Command) WithTTY() (*Command, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogRecord is a single line of output captured from a command, along with
+// the stream it was written to ("stdout" or "stderr") and the time at which
+// it arrived.
+type LogRecord struct {
+	Time    time.Time
+	Stream  string
+	Line    string
+	Command string
+}
+
+// RunRecords runs the command and returns every line written to stdout and
+// stderr as a LogRecord, in the order in which the lines arrived. If Stdout
+// and Stderr are the same writer, then the two streams can't be told apart,
+// and every line is recorded as "stdout".
+// Output is still written to the command's buffers as usual, and the
+// command's Stdout and Stderr are restored once it has finished.
+//
+// The error returned is the same as the error returned by Run. The records
+// captured before the failure are returned regardless.
+func (cmd *Command) RunRecords() ([]LogRecord, error) {
+	rec := &recorder{command: cmd.String()}
+	stdout := &lineWriter{fn: func(line string) { rec.add("stdout", line) }}
+	stderr := &lineWriter{fn: func(line string) { rec.add("stderr", line) }}
+	defer func(w, ew io.Writer) {
+		cmd.Stdout, cmd.Stderr = w, ew
+	}(cmd.Stdout, cmd.Stderr)
+	cmd.Stdout, cmd.Stderr = teeStreams(cmd.Stdout, cmd.Stderr, stdout, stderr)
+
+	err := cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	return rec.records, err
+}
+
+// teeStreams tees the stdout and stderr writers "w" and "ew" of a command to
+// "stdout" and "stderr", as with teeWriter. os/exec shares a single pipe when
+// both streams are the same writer, which keeps the order of their output,
+// so in that case the writer is teed once, to "stdout", and the result is
+// returned for both streams.
+func teeStreams(w, ew io.Writer,
+	stdout, stderr io.Writer) (io.Writer, io.Writer) {
+
+	if w != nil && ew == w {
+		shared := teeWriter(w, stdout)
+		return shared, shared
+	}
+	return teeWriter(w, stdout), teeWriter(ew, stderr)
+}
+
+// teeWriter returns a writer that writes to both w and extra. If w is nil,
+// then extra is returned.
+func teeWriter(w io.Writer, extra io.Writer) io.Writer {
+	if w == nil {
+		return extra
+	}
+	return io.MultiWriter(w, extra)
+}
+
+// recorder collects log records from the stdout and stderr writers, which
+// are written to concurrently by os/exec.
+type recorder struct {
+	mu      sync.Mutex
+	command string
+	records []LogRecord
+}
+
+func (r *recorder) add(stream, line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = append(r.records, LogRecord{
+		Time:    time.Now(),
+		Stream:  stream,
+		Line:    line,
+		Command: r.command,
+	})
+}
+
+// lineWriter splits everything written to it into lines and calls "fn"
+// with each complete line.
+type lineWriter struct {
+	fn      func(line string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(bytes.TrimSuffix(w.partial[:i], []byte{'\r'})))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush calls "fn" with any trailing output that wasn't terminated by a new
+// line.
+func (w *lineWriter) flush() {
+	if len(w.partial) > 0 {
+		w.fn(string(w.partial))
+		w.partial = nil
+	}
+}
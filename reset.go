@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"context"
+	"maps"
+	"os/exec"
+	"slices"
+)
+
+// Reset prepares a command that has already been run to be run again. The
+// embedded *exec.Cmd is replaced with a fresh one that has the same
+// configuration, and the stdout and stderr buffers are cleared.
+//
+// Note that BufStdin is not restored, since running the command consumes
+// it. Callers that need to provide input again should write it to BufStdin
+// after calling Reset. Similarly, a command whose stdin was piped from
+// another with StdinFromCommand reads from BufStdin again after Reset, since
+// the pipe is closed once the command has finished. The other command must
+// be reset and piped again with StdinFromCommand to run both again.
+func (cmd *Command) Reset() {
+	cmd.Cmd = cloneCmd(cmd.ctx, cmd.Cmd)
+	if cmd.ctx != nil {
+		cmd.cancelOnDone()
+	}
+	if cmd.source != nil {
+		if cmd.Stdin == cmd.source.r {
+			cmd.Stdin = cmd.BufStdin
+		}
+		cmd.source = nil
+	}
+	cmd.BufStdout.Reset()
+	cmd.BufStderr.Reset()
+	cmd.done = nil
+	cmd.tty = nil
+	cmd.clearStartedErr()
+	cmd.waitErr = nil
+	cmd.exited = nil
+	cmd.exitErr = nil
+	cmd.expectPos = 0
+}
+
+// Clone returns a new command that runs the same executable with the
+// arguments "arg" (rewritten by Wrapper, if it's set), and with the same
+// configuration as "cmd" (e.g., its environment, working directory, timeout,
+// PreRun function, SuccessCodes and the context given to NewContext). This is
+// useful for configuring a command once and using it as a template for
+// running the program with different arguments.
+//
+// The new command is independent of "cmd": changing one doesn't affect the
+// other. It has its own buffers attached to its stdin, stdout and stderr,
+// like a command created with New, so output handlers (e.g., OnLine) and
+// any command piped to the stdin of "cmd" are not copied.
+func (cmd *Command) Clone(arg ...string) *Command {
+	name := cmd.name
+	if name == "" {
+		name = cmd.Path
+		if len(cmd.Args) > 0 {
+			name = cmd.Args[0]
+		}
+	}
+	c := newCommand(cmd.ctx, name, arg)
+	// The program isn't looked up again, since the clone should run the same
+	// executable, e.g., one found with PrependPath.
+	c.Path = cmd.Path
+	c.Cmd.Err = cmd.Cmd.Err
+	c.Env = slices.Clone(cmd.Env)
+	c.Dir = cmd.Dir
+	c.ExtraFiles = slices.Clone(cmd.ExtraFiles)
+	if cmd.SysProcAttr != nil {
+		attr := *cmd.SysProcAttr
+		c.SysProcAttr = &attr
+	}
+	c.WaitDelay = cmd.WaitDelay
+
+	c.PreRun = cmd.PreRun
+	c.Timeout = cmd.Timeout
+	c.SuccessCodes = slices.Clone(cmd.SuccessCodes)
+	c.ReadsStdin = cmd.ReadsStdin
+	c.Meta = maps.Clone(cmd.Meta)
+	c.configErr = cmd.configErr
+	c.clearStartedErr()
+	c.netns = cmd.netns
+	c.cgroup = cmd.cgroup
+	c.limits = cmd.limits
+	c.rlimits = cmd.rlimits
+	c.secretEnvKeys = slices.Clone(cmd.secretEnvKeys)
+	c.background = cmd.background
+	c.expand = cmd.expand
+	return c
+}
+
+// clearStartedErr forgets that the command was modified after it was started
+// (see AppendArgs), since that only concerns the run that was in progress.
+// Other configuration errors are kept.
+func (cmd *Command) clearStartedErr() {
+	if cmd.configErr == ErrAlreadyStarted {
+		cmd.configErr = nil
+	}
+}
+
+// cloneCmd returns a new *exec.Cmd with the same configuration as "c", but
+// none of its state from being run. If "ctx" isn't nil, the new command is
+// bound to it, as with exec.CommandContext.
+func cloneCmd(ctx context.Context, c *exec.Cmd) *exec.Cmd {
+	clone := new(exec.Cmd)
+	if ctx != nil {
+		// Only exec.CommandContext can set the context of an *exec.Cmd. It
+		// also sets Cancel to kill the new command's process, which must not
+		// be replaced by the Cancel of "c", since that kills the process of
+		// "c".
+		clone = exec.CommandContext(ctx, c.Path)
+	}
+	clone.Path = c.Path
+	clone.Args = append([]string(nil), c.Args...)
+	clone.Env = c.Env
+	clone.Dir = c.Dir
+	clone.Stdin = c.Stdin
+	clone.Stdout = c.Stdout
+	clone.Stderr = c.Stderr
+	clone.ExtraFiles = c.ExtraFiles
+	clone.SysProcAttr = c.SysProcAttr
+	clone.WaitDelay = c.WaitDelay
+	clone.Err = c.Err
+	return clone
+}
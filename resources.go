@@ -0,0 +1,50 @@
+package cmd
+
+import "errors"
+
+// Limits are resource limits for a command, which are enforced by the
+// kernel by placing the command's process in a transient cgroup (v2).
+type Limits struct {
+	// MemoryBytes is the maximum amount of memory the command may use. The
+	// command is killed if it exceeds it. Zero means no limit.
+	MemoryBytes int64
+
+	// CPUQuota is the maximum number of CPUs worth of time the command may
+	// use, e.g., 0.5 for half of one CPU. Zero means no limit.
+	CPUQuota float64
+
+	// Parent is the cgroup directory in which the transient cgroup is
+	// created. If it is empty, then "/sys/fs/cgroup" is used.
+	//
+	// The current process must be able to create cgroups in Parent, and the
+	// "memory" and "cpu" controllers must be enabled in Parent's
+	// "cgroup.subtree_control". For unprivileged processes, this usually
+	// means that Parent must be a cgroup delegated to the current user
+	// (e.g., by systemd with "Delegate=yes").
+	Parent string
+}
+
+// WithLimits configures the command to run with the resource limits in "l".
+// The transient cgroup is created when the command starts, and is removed
+// once the command has been waited on. If the cgroup can't be created or
+// configured, then Start (and therefore Run) returns an error. If it can't be
+// removed (e.g., because processes started by the command are still in it),
+// then Wait (and therefore Run) returns an error. Limits can't be combined
+// with WithCgroup.
+//
+// Resource limits are only supported on Linux. On other platforms, Start
+// (and therefore Run) returns ErrUnsupported.
+func (cmd *Command) WithLimits(l Limits) *Command {
+	cmd.limits = &l
+	return cmd
+}
+
+// cleanupCgroup removes the command's transient cgroup, if it has one, after
+// the command failed to start with "err". It returns "err", along with the
+// error from removing the cgroup, if any.
+func (cmd *Command) cleanupCgroup(err error) error {
+	if rmErr := cmd.removeTransientCgroup(); rmErr != nil {
+		return errors.Join(err, rmErr)
+	}
+	return err
+}
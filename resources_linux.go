@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// cpuPeriod is the period, in microseconds, over which a CPU quota is
+// enforced.
+const cpuPeriod = 100000
+
+// createTransientCgroup creates a new cgroup configured with the command's
+// limits, in which the command is started.
+func (cmd *Command) createTransientCgroup() error {
+	if cmd.cgroup != "" {
+		return fmt.Errorf("Could not create cgroup: the command is "+
+			"already configured to run in cgroup '%s'", cmd.cgroup)
+	}
+	parent := cmd.limits.Parent
+	if parent == "" {
+		parent = "/sys/fs/cgroup"
+	}
+	dir, err := os.MkdirTemp(parent, "cmd-")
+	if err != nil {
+		return fmt.Errorf("Could not create cgroup: %w", err)
+	}
+	cmd.transientCgroup = dir
+
+	if cmd.limits.MemoryBytes > 0 {
+		err := writeCgroupFile(dir, "memory.max",
+			strconv.FormatInt(cmd.limits.MemoryBytes, 10))
+		if err != nil {
+			return cmd.cleanupCgroup(err)
+		}
+	}
+	if cmd.limits.CPUQuota > 0 {
+		quota := int64(cmd.limits.CPUQuota * cpuPeriod)
+		err := writeCgroupFile(dir, "cpu.max",
+			fmt.Sprintf("%d %d", quota, cpuPeriod))
+		if err != nil {
+			return cmd.cleanupCgroup(err)
+		}
+	}
+	return nil
+}
+
+// removeTransientCgroup removes the command's transient cgroup, if it has
+// one. This only succeeds once every process in the cgroup has exited.
+func (cmd *Command) removeTransientCgroup() error {
+	if cmd.transientCgroup == "" {
+		return nil
+	}
+	dir := cmd.transientCgroup
+	cmd.transientCgroup = ""
+	if err := os.Remove(dir); err != nil {
+		return fmt.Errorf("Could not remove cgroup '%s': %w", dir, err)
+	}
+	return nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0)
+	if err != nil {
+		return fmt.Errorf("Could not set %s of cgroup '%s': %w",
+			name, dir, err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package cmd
+
+func (cmd *Command) createTransientCgroup() error {
+	return ErrUnsupported
+}
+
+func (cmd *Command) removeTransientCgroup() error {
+	return nil
+}
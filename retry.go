@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy describes how a failed command is retried, with an exponential
+// backoff between attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a command is run, including
+	// the first. If it is less than 1, the command is run once.
+	MaxAttempts int
+
+	// Backoff is how long to wait before the first retry. The wait is
+	// multiplied by Multiplier after each retry, up to MaxBackoff (if it is
+	// positive). If Multiplier is less than 1, then 2 is used.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+
+	// Jitter randomizes each wait to within plus or minus Jitter times the
+	// computed wait, so that many commands retrying at once don't do so in
+	// lock step. It should be between 0 and 1. The default of 0 means no
+	// jitter.
+	Jitter float64
+}
+
+// Run runs "cmd" until it succeeds or has been run MaxAttempts times, and
+// returns the error of the last attempt. A *Command is reset with
+// (*Command).Reset before each retry. Any other kind of command must support
+// being run more than once.
+func (p RetryPolicy) Run(cmd Commander) error {
+	// Each run gets its own source, so that the jitter of commands retrying
+	// concurrently isn't correlated.
+	r := rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+
+	err := cmd.Run()
+	for attempt := 1; err != nil && attempt < p.MaxAttempts; attempt++ {
+		time.Sleep(p.backoff(attempt, r))
+		if c, ok := cmd.(*Command); ok {
+			c.Reset()
+		}
+		err = cmd.Run()
+	}
+	return err
+}
+
+// backoff returns how long to wait before the given retry, where the first
+// retry is 1.
+func (p RetryPolicy) backoff(retry int, r *rand.Rand) time.Duration {
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 2
+	}
+	wait := float64(p.Backoff)
+	for i := 1; i < retry; i++ {
+		wait *= mult
+		if p.MaxBackoff > 0 && wait >= float64(p.MaxBackoff) {
+			wait = float64(p.MaxBackoff)
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		wait += wait * p.Jitter * (2*r.Float64() - 1)
+	}
+	return time.Duration(wait)
+}
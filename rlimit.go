@@ -0,0 +1,31 @@
+package cmd
+
+import "time"
+
+// rlimits are the limits set on a command by WithResourceLimits. A zero
+// value means that there is no limit.
+type rlimits struct {
+	cpuTime  time.Duration
+	memBytes int64
+}
+
+// WithResourceLimits limits the CPU time and the virtual memory (address
+// space) of the command's process with resource limits (RLIMIT_CPU and
+// RLIMIT_AS). A process that uses more than "cpuTime" of CPU time is killed
+// by the kernel, and allocations that would take its address space beyond
+// "memBytes" fail. A limit of zero means no limit. CPU time is rounded up to
+// a whole number of seconds. It must be called before the command is
+// started.
+//
+// The limits are set as soon as the process has started, so a process may
+// briefly run without them. Unlike WithLimits, they apply to each process
+// separately, and are inherited by any children it starts.
+//
+// Resource limits are only set on Linux. On other platforms, they are
+// silently ignored.
+func (cmd *Command) WithResourceLimits(cpuTime time.Duration,
+	memBytes int64) *Command {
+
+	cmd.rlimits = &rlimits{cpuTime: cpuTime, memBytes: memBytes}
+	return cmd
+}
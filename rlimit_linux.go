@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"errors"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// setRlimits sets the resource limits of the started command. A process
+// that has already exited is left alone.
+func (cmd *Command) setRlimits() error {
+	set := func(resource int, limit uint64) error {
+		rlim := syscall.Rlimit{Cur: limit, Max: limit}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+			uintptr(cmd.Process.Pid), uintptr(resource),
+			uintptr(unsafe.Pointer(&rlim)), 0, 0, 0)
+		if errno != 0 && errno != syscall.ESRCH {
+			return errno
+		}
+		return nil
+	}
+
+	var errs []error
+	if t := cmd.rlimits.cpuTime; t > 0 {
+		secs := uint64((t + time.Second - 1) / time.Second)
+		errs = append(errs, set(syscall.RLIMIT_CPU, secs))
+	}
+	if m := cmd.rlimits.memBytes; m > 0 {
+		errs = append(errs, set(syscall.RLIMIT_AS, uint64(m)))
+	}
+	return errors.Join(errs...)
+}
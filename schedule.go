@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// RunManySchedule is like RunMany, except "next" decides which command a
+// worker runs when it becomes free, e.g., to run commands by priority.
+// "next" is called with the indices of the commands that haven't been
+// started yet, in ascending order, and must return one of them. It's never
+// called concurrently, and "pending" must not be retained.
+//
+// If "next" is nil, or returns an index that isn't pending, then the first
+// pending command is run. (So a nil "next" runs the commands in order, like
+// RunMany.)
+func (cmds Commands) RunManySchedule(workers int,
+	next func(pending []int) int) []error {
+
+	mu := new(sync.Mutex)
+	pending := make([]int, len(cmds))
+	for i := range pending {
+		pending[i] = i
+	}
+	take := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+
+		pos := 0
+		if next != nil {
+			if p := slices.Index(pending, next(pending)); p >= 0 {
+				pos = p
+			}
+		}
+		job := pending[pos]
+		pending = slices.Delete(pending, pos, pos+1)
+		return job
+	}
+
+	// Each slot runs whichever command is scheduled when a worker gets to
+	// it, so the errors are collected by the index of the command instead.
+	errs := make([]error, len(cmds))
+	slots := make(Commands, len(cmds))
+	for i := range slots {
+		slots[i] = commanderFunc(func() error {
+			job := take()
+			errs[job] = runContext(context.Background(), cmds[job])
+			return nil
+		})
+	}
+	slots.RunMany(workers)
+	return errs
+}
@@ -0,0 +1,49 @@
+package cmd
+
+// Seq is a sequence of commands with the control flow of "&&" and "||" in a
+// shell, but without a shell. e.g., the equivalent of "a && b || c" is
+//
+//	err := new(cmd.Seq).Then(a).Then(b).Else(c).Run()
+//
+// As in a shell, whether each command runs depends on whether the last
+// command that ran succeeded, and commands that don't run are skipped. The
+// zero value is an empty sequence, which is considered a success, so that
+// the first command added with Then always runs.
+//
+// Since Seq is a Commander, sequences can be nested and run in a pool.
+type Seq struct {
+	steps []seqStep
+}
+
+type seqStep struct {
+	cmd Commander
+	// onSuccess is true if the command runs when the last command that ran
+	// succeeded, and false if it runs when it failed.
+	onSuccess bool
+}
+
+// Then adds "cmd" to the sequence, to be run only if the last command that
+// ran succeeded (like "&&").
+func (s *Seq) Then(cmd Commander) *Seq {
+	s.steps = append(s.steps, seqStep{cmd: cmd, onSuccess: true})
+	return s
+}
+
+// Else adds "cmd" to the sequence, to be run only if the last command that
+// ran failed (like "||").
+func (s *Seq) Else(cmd Commander) *Seq {
+	s.steps = append(s.steps, seqStep{cmd: cmd, onSuccess: false})
+	return s
+}
+
+// Run runs the sequence and returns the error of the last command that ran,
+// or nil if no command ran.
+func (s *Seq) Run() error {
+	var err error
+	for _, step := range s.steps {
+		if (err == nil) == step.onSuccess {
+			err = step.cmd.Run()
+		}
+	}
+	return err
+}
@@ -0,0 +1,4 @@
+package cmd
+
+// The syscall package doesn't define SYS_SETNS on 386.
+const sysSetns = 346
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// CommandSpec describes a command in a configuration file, e.g., in JSON:
+//
+//	[{"cmd": "git", "args": ["pull"], "dir": "/repo", "timeout": "30s"}]
+//
+// Lists of specs are decoded from JSON by NewCommandsFromJSON. Since this
+// package has no dependencies, it doesn't decode YAML itself. Instead, the
+// fields are also tagged for the common YAML packages, so that a list of
+// specs can be decoded with one of them and passed to NewCommandsFromSpecs.
+type CommandSpec struct {
+	// Cmd is the name of the program to run. It is required.
+	Cmd  string   `json:"cmd" yaml:"cmd"`
+	Args []string `json:"args" yaml:"args"`
+	Dir  string   `json:"dir" yaml:"dir"`
+	// Env holds variables added to the environment of the current process.
+	Env map[string]string `json:"env" yaml:"env"`
+	// Timeout is parsed with time.ParseDuration, e.g., "1m30s". If it's
+	// empty, then the command has no timeout of its own.
+	Timeout string `json:"timeout" yaml:"timeout"`
+}
+
+// NewCommandsFromSpecs creates a list of commands from a list of specs,
+// where each command is configured with the program, arguments, working
+// directory, environment and timeout of its spec.
+func NewCommandsFromSpecs(specs []CommandSpec) (Commands, error) {
+	cmds := make(Commands, len(specs))
+	for i, spec := range specs {
+		if spec.Cmd == "" {
+			return nil, fmt.Errorf("Error in command %d: missing 'cmd'.", i)
+		}
+		cmd := NewWithOptions(spec.Cmd,
+			WithArgs(spec.Args...), Dir(spec.Dir), Env(spec.Env))
+		if spec.Timeout != "" {
+			d, err := time.ParseDuration(spec.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("Error in command %d ('%s'): "+
+					"invalid timeout: %w.", i, spec.Cmd, err)
+			}
+			cmd.Timeout = d
+		}
+		cmds[i] = cmd
+	}
+	return cmds, nil
+}
+
+// NewCommandsFromJSON is like NewCommandsFromSpecs, except the specs are
+// decoded from a JSON list read from "r". Unknown fields are an error, so
+// that typos don't go unnoticed.
+func NewCommandsFromJSON(r io.Reader) (Commands, error) {
+	var specs []CommandSpec
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&specs); err != nil {
+		return nil, fmt.Errorf("Error decoding commands: %w.", err)
+	}
+	return NewCommandsFromSpecs(specs)
+}
+
+// Separators for NewCommandsFromEnvVar.
+const (
+	// SplitColon splits a list like PATH on Unix, e.g., "vet:lint:test".
+	SplitColon = ":"
+	// SplitNewline splits a list with one entry per line.
+	SplitNewline = "\n"
+)
+
+// NewCommandsFromEnvVar creates a list of commands from the value of the
+// environment variable "envVar", which is split into entries by "sep" (e.g.,
+// SplitColon or SplitNewline). Every entry is passed to "argsFn", which
+// returns the name of the program to run for it and its arguments. Entries
+// are trimmed of white space, and empty entries are skipped.
+//
+// An error is returned if the variable isn't set, or if "argsFn" returns an
+// empty program name. A variable that is set but empty yields no commands.
+func NewCommandsFromEnvVar(envVar, sep string,
+	argsFn func(entry string) (string, []string)) (Commands, error) {
+
+	val, ok := os.LookupEnv(envVar)
+	if !ok {
+		return nil, fmt.Errorf("Error reading commands from $%s: "+
+			"the variable isn't set.", envVar)
+	}
+	var cmds Commands
+	for _, entry := range strings.Split(val, sep) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, args := argsFn(entry)
+		if name == "" {
+			return nil, fmt.Errorf("Error reading commands from $%s: "+
+				"no program for entry '%s'.", envVar, entry)
+		}
+		cmds = append(cmds, New(name, args...))
+	}
+	return cmds, nil
+}
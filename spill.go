@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// SpillBuffer is a buffer for output that may be too large to keep in
+// memory. Output is kept in memory until it exceeds a threshold, after which
+// all of it is moved to a temporary file, and the rest is written there.
+// The output is read back with Output or OutputBytes, which remove the
+// temporary file.
+//
+// A SpillBuffer must be created with NewSpillBuffer. It is safe for
+// concurrent use.
+type SpillBuffer struct {
+	mu        sync.Mutex
+	threshold int
+	mem       bytes.Buffer
+	file      *os.File
+	n         int64
+}
+
+// NewSpillBuffer returns an empty buffer that keeps up to "threshold" bytes
+// in memory before spilling to a temporary file.
+func NewSpillBuffer(threshold int) *SpillBuffer {
+	return &SpillBuffer{threshold: threshold}
+}
+
+// SpillToDisk replaces the command's stdout with a SpillBuffer that keeps up
+// to "threshold" bytes of output in memory, and returns it. BufStdout is no
+// longer used. This bounds the memory used to capture the output of a
+// command that writes a lot of it while it runs. It must be called before
+// the command is started.
+//
+// Once the command has finished, its output is returned by (and the
+// temporary file is removed by) Output or OutputBytes. If the output isn't
+// needed, Close removes the temporary file.
+func (cmd *Command) SpillToDisk(threshold int) *SpillBuffer {
+	buf := NewSpillBuffer(threshold)
+	cmd.Stdout = buf
+	return buf
+}
+
+// Write appends to the buffer, moving its contents to a temporary file if
+// they would exceed the threshold.
+func (b *SpillBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.file == nil && b.mem.Len()+len(p) > b.threshold {
+		f, err := os.CreateTemp("", "cmd-spill-*")
+		if err != nil {
+			return 0, fmt.Errorf("Could not create spill file: %w", err)
+		}
+		if _, err := f.Write(b.mem.Bytes()); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return 0, fmt.Errorf("Could not write spill file: %w", err)
+		}
+		b.file = f
+		b.mem.Reset()
+	}
+
+	var n int
+	var err error
+	if b.file != nil {
+		n, err = b.file.Write(p)
+	} else {
+		n, err = b.mem.Write(p)
+	}
+	b.n += int64(n)
+	return n, err
+}
+
+// Len returns the number of bytes written to the buffer since it was last
+// read.
+func (b *SpillBuffer) Len() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.n
+}
+
+// Spilled reports whether the buffer's contents are in a temporary file.
+func (b *SpillBuffer) Spilled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.file != nil
+}
+
+// OutputBytes returns everything written to the buffer, and empties it. If
+// the contents were spilled to a temporary file, then the file is removed.
+func (b *SpillBuffer) OutputBytes() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	defer b.reset()
+	if b.file == nil {
+		return bytes.Clone(b.mem.Bytes()), nil
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("Error reading spill file: %w.", err)
+	}
+	data, err := io.ReadAll(b.file)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading spill file: %w.", err)
+	}
+	return data, nil
+}
+
+// Output is like OutputBytes, except the contents are returned as a string.
+func (b *SpillBuffer) Output() (string, error) {
+	data, err := b.OutputBytes()
+	return string(data), err
+}
+
+// Close empties the buffer and removes its temporary file, if any.
+func (b *SpillBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.reset()
+}
+
+// reset empties the buffer and removes its temporary file, if any. The
+// buffer's lock must be held.
+func (b *SpillBuffer) reset() error {
+	b.mem.Reset()
+	b.n = 0
+	if b.file == nil {
+		return nil
+	}
+	f := b.file
+	b.file = nil
+	f.Close()
+	return os.Remove(f.Name())
+}
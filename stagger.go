@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RunManyStagger is like RunMany, except that commands are started at least
+// "delay" apart from one another, across all workers. This smooths out the
+// burst of processes that would otherwise be started all at once.
+func (cmds Commands) RunManyStagger(workers int, delay time.Duration) []error {
+	s := &stagger{delay: delay}
+	staggered := make(Commands, len(cmds))
+	for i, c := range cmds {
+		staggered[i] = commanderFunc(func() error {
+			s.wait()
+			return runContext(context.Background(), c)
+		})
+	}
+	return staggered.RunMany(workers)
+}
+
+// stagger spaces out the times at which callers of wait return.
+type stagger struct {
+	mu    sync.Mutex
+	next  time.Time
+	delay time.Duration
+}
+
+// wait blocks until at least "delay" has passed since the last call to wait
+// returned.
+func (s *stagger) wait() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.next.After(now) {
+		time.Sleep(s.next.Sub(now))
+		now = s.next
+	}
+	s.next = now.Add(s.delay)
+}
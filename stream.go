@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// RunFromChan is the streaming analog of RunMany. Commands are received from
+// "jobs" and run by a pool with a number of workers specified by "workers",
+// and the result of each command is sent on the channel returned as soon as
+// it finishes. If "workers" is less than 1, then the value of GOMAXPROCS is
+// used.
+//
+// The Index of each result is the order in which its command was received.
+// Results are sent in the order in which commands finish.
+//
+// The channel returned is closed once "jobs" is closed and every command
+// received has finished. If "ctx" is done first, then no more commands are
+// received, and the channel is closed once the commands already received
+// have finished. Commands that implement ContextCommander are cancelled.
+//
+// The caller must receive every result, or else the workers will block.
+func RunFromChan(ctx context.Context, jobs <-chan Commander,
+	workers int) <-chan Result {
+
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	type job struct {
+		index int
+		cmd   Commander
+	}
+	indexed := make(chan job)
+	results := make(chan Result)
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := range indexed {
+				err := runContext(ctx, j.cmd)
+				results <- newResult(j.index, j.cmd, err)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(indexed)
+
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case c, ok := <-jobs:
+				if !ok {
+					return
+				}
+				select {
+				case indexed <- job{i, c}:
+				case <-ctx.Done():
+					results <- newResult(i, c, skippedErr(ctx))
+					return
+				}
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// RunManyOrdered is like RunManyContext, except the result of each command
+// is sent on the channel returned instead of being collected in a list. The
+// commands are run concurrently, but their results are sent in the order of
+// "cmds", so that the Index of the i'th result sent is i. The result of a
+// command that finishes before those preceding it is held back until they
+// have all been sent.
+//
+// The channel returned is closed once a result has been sent for every
+// command. If "ctx" is done first, then the errors of the commands that
+// weren't started or that failed are as described for RunManyContext.
+//
+// The caller must receive every result, or else the workers will block.
+func (cmds Commands) RunManyOrdered(ctx context.Context,
+	workers int) <-chan Result {
+
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	jobs := make(chan int)
+	finished := make(chan Result)
+	results := make(chan Result)
+	wg := new(sync.WaitGroup)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				var err error
+				if ctx.Err() != nil {
+					err = skippedErr(ctx)
+				} else if err = runContext(ctx, cmds[job]); err != nil {
+					if ctx.Err() != nil {
+						err = fmt.Errorf("%w: %w", batchErr(ctx), err)
+					}
+				}
+				finished <- newResult(job, cmds[job], err)
+			}
+		}()
+	}
+	go func() {
+		for i := range cmds {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(finished)
+	}()
+	go func() {
+		defer close(results)
+
+		// Results that have finished out of order, by index.
+		held := make(map[int]Result)
+		next := 0
+		for r := range finished {
+			held[r.Index] = r
+			for {
+				r, ok := held[next]
+				if !ok {
+					break
+				}
+				delete(held, next)
+				results <- r
+				next++
+			}
+		}
+	}()
+	return results
+}
+
+// RunManyOrderedCallback is like RunMany, except "fn" is called with the
+// result of each command as soon as it and every command before it have
+// finished. So "fn" sees the results in the order of "cmds", but doesn't
+// have to wait for the whole batch. "fn" is never called concurrently, and
+// while it runs, results that finish are held back.
+func (cmds Commands) RunManyOrderedCallback(workers int,
+	fn func(Result)) []error {
+
+	errs := make([]error, len(cmds))
+	for r := range cmds.RunManyOrdered(context.Background(), workers) {
+		errs[r.Index] = r.Err
+		fn(r)
+	}
+	return errs
+}
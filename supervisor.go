@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrSupervisorStopped is returned by the methods of a SupervisedProcess
+// that has been stopped.
+var ErrSupervisorStopped = errors.New("supervised process stopped")
+
+// SupervisorStatus is the state of a SupervisedProcess.
+type SupervisorStatus int
+
+const (
+	// SupervisorRunning means that the command is running.
+	SupervisorRunning SupervisorStatus = iota
+	// SupervisorBackoff means that the command failed, and is waiting to be
+	// restarted.
+	SupervisorBackoff
+	// SupervisorStable means that the command finished successfully, so it
+	// won't be restarted.
+	SupervisorStable
+	// SupervisorFailed means that the command failed after being restarted
+	// the maximum number of times, so it won't be restarted again.
+	SupervisorFailed
+	// SupervisorStopped means that the process was stopped with Stop.
+	SupervisorStopped
+)
+
+func (s SupervisorStatus) String() string {
+	switch s {
+	case SupervisorRunning:
+		return "running"
+	case SupervisorBackoff:
+		return "backoff"
+	case SupervisorStable:
+		return "stable"
+	case SupervisorFailed:
+		return "failed"
+	case SupervisorStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// Supervisor runs commands in the background and restarts them when they
+// fail, e.g., to keep daemons running. The zero value is ready to use.
+type Supervisor struct {
+	mu    sync.Mutex
+	procs []*SupervisedProcess
+}
+
+// SupervisedProcess is a command run by a Supervisor.
+type SupervisedProcess struct {
+	cmd         func() Commander
+	backoff     func(int) time.Duration
+	maxRestarts int
+
+	mu sync.Mutex
+	// wake interrupts the wait before a restart, when the process is
+	// stopped or restarted.
+	wake chan struct{}
+	// cancelRun stops the command that is running, if any.
+	cancelRun context.CancelFunc
+	// done is closed once the command has stopped for good (for now).
+	done     chan struct{}
+	status   SupervisorStatus
+	failures int
+	restarts int
+	restart  bool
+	stopped  bool
+	lastErr  error
+}
+
+// Supervise runs the command returned by "cmd" in the background. Whenever
+// the command fails, it waits "backoff(n)" and then runs a new command
+// returned by "cmd", where "n" is the number of times it has failed in a row
+// (starting at 1). It gives up once the command has been restarted
+// "maxRestarts" times in a row without succeeding. If "maxRestarts" is
+// negative, then there is no limit. If "backoff" is nil, then the command is
+// restarted right away.
+//
+// "cmd" is called for every run, since a *Command can only be run once. A
+// command that finishes successfully isn't restarted.
+func (s *Supervisor) Supervise(cmd func() Commander,
+	backoff func(int) time.Duration, maxRestarts int) *SupervisedProcess {
+
+	p := &SupervisedProcess{
+		cmd:         cmd,
+		backoff:     backoff,
+		maxRestarts: maxRestarts,
+		wake:        make(chan struct{}, 1),
+	}
+	p.start()
+
+	s.mu.Lock()
+	s.procs = append(s.procs, p)
+	s.mu.Unlock()
+	return p
+}
+
+// Stop stops every process started by the supervisor, as with
+// (*SupervisedProcess).Stop.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	procs := s.procs
+	s.mu.Unlock()
+
+	for _, p := range procs {
+		p.Stop()
+	}
+}
+
+// Status returns the current state of the process.
+func (p *SupervisedProcess) Status() SupervisorStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.status
+}
+
+// Restarts returns the number of times the command has been restarted
+// after failing.
+func (p *SupervisedProcess) Restarts() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.restarts
+}
+
+// Err returns the error of the last run of the command, or nil if it
+// succeeded (or hasn't finished yet).
+func (p *SupervisedProcess) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.lastErr
+}
+
+// Stop stops the command, if it's running, and stops it from being
+// restarted. Stop returns once the command has stopped. The command is
+// stopped by cancelling the context given to it, so a *Command is killed
+// (see RunContext). Other kinds of commands are only stopped if they
+// implement ContextCommander. Otherwise, Stop waits for them to finish.
+//
+// It returns ErrSupervisorStopped if the process was already stopped.
+func (p *SupervisedProcess) Stop() error {
+	p.mu.Lock()
+	if p.stopped {
+		p.mu.Unlock()
+		return ErrSupervisorStopped
+	}
+	p.stopped = true
+	p.interrupt()
+	done := p.done
+	p.mu.Unlock()
+
+	<-done
+	p.mu.Lock()
+	p.status = SupervisorStopped
+	p.mu.Unlock()
+	return nil
+}
+
+// Restart stops the command, if it's running, and then runs it again right
+// away, with its count of failures reset. A process that has become stable
+// or failed is started again.
+//
+// It returns ErrSupervisorStopped if the process has been stopped.
+func (p *SupervisedProcess) Restart() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped {
+		return ErrSupervisorStopped
+	}
+	select {
+	case <-p.done:
+		p.failures = 0
+		p.start()
+	default:
+		p.restart = true
+		p.interrupt()
+	}
+	return nil
+}
+
+// start runs the supervision loop in the background. The lock must be held
+// if the process may be in use by another goroutine.
+func (p *SupervisedProcess) start() {
+	p.done = make(chan struct{})
+	p.status = SupervisorRunning
+	go p.loop(p.done)
+}
+
+// interrupt stops the running command, or the wait before a restart. The
+// lock must be held.
+func (p *SupervisedProcess) interrupt() {
+	if p.cancelRun != nil {
+		p.cancelRun()
+	}
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *SupervisedProcess) loop(done chan struct{}) {
+	defer close(done)
+
+	for {
+		p.mu.Lock()
+		if p.stopped {
+			p.mu.Unlock()
+			return
+		}
+		if p.restart {
+			p.restart = false
+			p.failures = 0
+		}
+		// Discard an interruption meant for a run that has already ended.
+		select {
+		case <-p.wake:
+		default:
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancelRun = cancel
+		p.status = SupervisorRunning
+		p.mu.Unlock()
+
+		err := runContext(ctx, p.cmd())
+		cancel()
+
+		p.mu.Lock()
+		p.cancelRun = nil
+		p.lastErr = err
+		switch {
+		case p.stopped:
+			p.mu.Unlock()
+			return
+		case p.restart:
+			p.mu.Unlock()
+			continue
+		case err == nil:
+			p.status = SupervisorStable
+			p.mu.Unlock()
+			return
+		case p.maxRestarts >= 0 && p.failures >= p.maxRestarts:
+			p.status = SupervisorFailed
+			p.mu.Unlock()
+			return
+		}
+		p.failures++
+		p.restarts++
+		p.status = SupervisorBackoff
+		var delay time.Duration
+		if p.backoff != nil {
+			delay = p.backoff(p.failures)
+		}
+		p.mu.Unlock()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-p.wake:
+			timer.Stop()
+		}
+	}
+}
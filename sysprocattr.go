@@ -0,0 +1,21 @@
+//go:build unix || windows
+
+package cmd
+
+import "syscall"
+
+// WithSysProcAttr calls "fn" with the command's SysProcAttr, which is
+// created first if it's nil. This is an escape hatch for setting any
+// platform specific attribute of the process (e.g., Pdeathsig or Chroot on
+// Linux) that this package doesn't otherwise provide a method for. It must be
+// called before the command is started.
+//
+// Note that other methods, such as WithUserAndGroup, also set fields of
+// SysProcAttr. Whichever is called last wins for any field set by both.
+func (cmd *Command) WithSysProcAttr(fn func(*syscall.SysProcAttr)) *Command {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	fn(cmd.SysProcAttr)
+	return cmd
+}
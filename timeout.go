@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// defaultTimeout is the timeout used by commands whose Timeout is zero.
+var defaultTimeout atomic.Int64
+
+// SetDefaultTimeout sets the timeout used for every command whose Timeout
+// field is zero. A command's timeout takes precedence as follows:
+//
+//   - If Timeout is positive, it is used.
+//   - If Timeout is negative, the command has no timeout.
+//   - If Timeout is zero, the default timeout is used.
+//
+// A default of zero (the initial value) means there is no default timeout.
+// SetDefaultTimeout is safe to call concurrently with running commands.
+func SetDefaultTimeout(d time.Duration) {
+	defaultTimeout.Store(int64(d))
+}
+
+// timeout returns the effective timeout of the command, or zero if it has
+// none.
+func (cmd *Command) timeout() time.Duration {
+	switch {
+	case cmd.Timeout > 0:
+		return cmd.Timeout
+	case cmd.Timeout < 0:
+		return 0
+	}
+	return time.Duration(defaultTimeout.Load())
+}
+
+// WithTimeout sets the Timeout of the command, and returns the command. Once
+// the command has started, its process is killed if it is still running
+// after "d", and Wait (or Run) returns a *TimeoutError.
+func (cmd *Command) WithTimeout(d time.Duration) *Command {
+	cmd.Timeout = d
+	return cmd
+}
+
+// deadline kills a running command once its timeout expires.
+type deadline struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   func() bool
+	// fired is closed once the command has been killed (or the kill has
+	// failed), and killed records whether it was.
+	fired  chan struct{}
+	killed bool
+}
+
+// startDeadline arms the timeout of a command that has just started, if it
+// has one. The timeout is derived from the context given to NewContext, if
+// any.
+func (cmd *Command) startDeadline() {
+	t := cmd.timeout()
+	if t <= 0 {
+		return
+	}
+	parent := cmd.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, t)
+	d := &deadline{ctx: ctx, cancel: cancel, fired: make(chan struct{})}
+	proc := cmd.Process
+	d.stop = context.AfterFunc(ctx, func() {
+		defer close(d.fired)
+		d.killed = proc.Kill() == nil
+	})
+	cmd.deadline = d
+}
+
+// stopDeadline disarms the timeout of a command that has been waited on. If
+// the command was killed because of its timeout or because the context given
+// to NewContext is done, then the error returned reports it instead of "err".
+func (cmd *Command) stopDeadline(err error) error {
+	if d := cmd.deadline; d != nil {
+		cmd.deadline = nil
+		defer d.cancel()
+		if !d.stop() {
+			<-d.fired
+			if err != nil && d.killed && cmd.terminated() {
+				timeout := cmd.timeout()
+				if cmd.ctx != nil && cmd.ctx.Err() != nil {
+					timeout = 0
+				}
+				return cmd.killedErr(d.ctx, timeout)
+			}
+		}
+	}
+	if err != nil && cmd.ctxKilled.Load() && cmd.terminated() {
+		return cmd.killedErr(cmd.ctx, 0)
+	}
+	return err
+}
+
+// cancelOnDone makes exec.CommandContext kill the command's process when the
+// context given to NewContext is done, like it does by default, but also
+// records whether it did, so that Wait can report it.
+func (cmd *Command) cancelOnDone() {
+	ecmd := cmd.Cmd
+	ecmd.Cancel = func() error {
+		err := ecmd.Process.Kill()
+		cmd.ctxKilled.Store(err == nil)
+		return err
+	}
+}
+
+// terminated returns true if the command's process was terminated by a
+// signal, rather than exiting on its own, as is the case when it's killed.
+// Killing a process succeeds even when it has already exited, as long as it
+// hasn't been waited on, so this is what tells whether a kill had any effect.
+// Windows has no signals, but killing a process fails once it has exited.
+func (cmd *Command) terminated() bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return cmd.ProcessState != nil && cmd.ProcessState.ExitCode() == -1
+}
+
+// killedErr returns the error of a command that was killed because "ctx" was
+// done. "timeout" is the timeout of "ctx", or zero if it isn't known.
+func (cmd *Command) killedErr(ctx context.Context,
+	timeout time.Duration) error {
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{
+			Cmd:        cmd.String(),
+			Timeout:    timeout,
+			Underlying: ctx.Err(),
+			describe:   cmd.describe(),
+			stderr:     cmd.stderrDetail(),
+		}
+	}
+	return fmt.Errorf("Error running %s: %w.%s",
+		cmd.describe(), ctx.Err(), cmd.stderrDetail())
+}
+
+// TimeoutError is the error returned when a command is killed because it ran
+// for longer than its timeout, or past the deadline of the context it was run
+// with (e.g., by RunContext).
+type TimeoutError struct {
+	// Cmd is the command that timed out, as returned by its String method.
+	Cmd string
+	// Timeout is the timeout of the command, or zero if it was killed
+	// because of the deadline of a context.
+	Timeout time.Duration
+	// Underlying is the error of the context whose deadline was exceeded,
+	// i.e., context.DeadlineExceeded.
+	Underlying error
+
+	// describe and stderr are the command's description and its stderr
+	// output, formatted as in the other errors returned by Wait.
+	describe, stderr string
+}
+
+func (e *TimeoutError) Error() string {
+	describe := e.describe
+	if describe == "" {
+		describe = fmt.Sprintf("'%s'", e.Cmd)
+	}
+	if e.Timeout > 0 {
+		return fmt.Sprintf("Error running %s: timed out after %s.%s",
+			describe, e.Timeout, e.stderr)
+	}
+	return fmt.Sprintf("Error running %s: %s.%s",
+		describe, e.Underlying, e.stderr)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Underlying
+}
+
+// IsTimeout returns true if "err" is or wraps a *TimeoutError.
+func IsTimeout(err error) bool {
+	var te *TimeoutError
+	return errors.As(err, &te)
+}
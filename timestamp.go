@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// RunManyTimestamped is like RunMany, except every line of output captured
+// from each command is also written to "w", prefixed with the time it was
+// written (in RFC 3339 format), the index of the command and the stream it
+// was written to. e.g.,
+//
+//	2024-05-01T12:00:00.123456789Z [3 stderr] warning: disk almost full
+//
+// Lines from different commands are interleaved in the order in which they
+// arrive, and writes to "w" are serialized. Output is still captured as
+// usual, and the commands' stdout and stderr are restored once they have
+// finished. The output of a command whose stdout and stderr are the same
+// writer is all labeled "stdout", since the streams can't be told apart.
+// Only the output of *Command and *exec.Cmd values can be timestamped. Other
+// commands are run as usual.
+func (cmds Commands) RunManyTimestamped(workers int, w io.Writer) []error {
+	mu := new(sync.Mutex)
+	var writers []*lineWriter
+	timestamped := func(i int, stream string) *lineWriter {
+		lw := &lineWriter{fn: func(line string) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			fmt.Fprintf(w, "%s [%d %s] %s\n",
+				time.Now().Format(time.RFC3339Nano), i, stream, line)
+		}}
+		writers = append(writers, lw)
+		return lw
+	}
+	for i, c := range cmds {
+		var ecmd *exec.Cmd
+		switch c := c.(type) {
+		case *Command:
+			ecmd = c.Cmd
+		case *exec.Cmd:
+			ecmd = c
+		default:
+			continue
+		}
+		defer func(w, ew io.Writer) {
+			ecmd.Stdout, ecmd.Stderr = w, ew
+		}(ecmd.Stdout, ecmd.Stderr)
+		ecmd.Stdout, ecmd.Stderr = teeStreams(ecmd.Stdout, ecmd.Stderr,
+			timestamped(i, "stdout"), timestamped(i, "stderr"))
+	}
+
+	errs := cmds.RunMany(workers)
+	for _, lw := range writers {
+		lw.flush()
+	}
+	return errs
+}
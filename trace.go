@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// Tracer creates spans for tracing the commands run by RunManyWithTrace. It
+// is a small subset of the tracing API of OpenTelemetry, so that this
+// package doesn't depend on it. A trace.Tracer from OpenTelemetry can be used
+// by wrapping it in a type that implements this interface, and NoopTracer
+// can be used when tracing isn't wanted.
+type Tracer interface {
+	// Start starts a new span with the given name, as a child of the span in
+	// "ctx" (if any). The context returned holds the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single operation within a trace. See Tracer.
+type Span interface {
+	// SetAttribute records an attribute of the operation. The value is
+	// either a string, an int, an int64 or a bool.
+	SetAttribute(key string, value any)
+	// SetError marks the operation as failed with the given error.
+	SetError(err error)
+	// End completes the span.
+	End()
+}
+
+// NoopTracer is a Tracer whose spans do nothing.
+type NoopTracer struct{}
+
+// Start returns "ctx" and a span that does nothing.
+func (NoopTracer) Start(ctx context.Context, name string) (context.Context,
+	Span) {
+
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value any) {}
+func (noopSpan) SetError(err error)                 {}
+func (noopSpan) End()                               {}
+
+// RunManyWithTrace is like RunManyContext, except the batch is traced with
+// "tracer". A span named "RunMany" is created for the whole batch, with a
+// child span for each command that is started. Commands that are skipped
+// have no span.
+//
+// The span of each command is named after its program (if it's a *Command
+// or *exec.Cmd), and records the command, its duration in milliseconds
+// and, once it has exited, its exit code as the attributes "cmd.command",
+// "cmd.duration_ms" and "cmd.exit_code". If the command fails, then its
+// error is set on the span. The error of the batch's span reports how many
+// commands failed, if any did.
+func (cmds Commands) RunManyWithTrace(ctx context.Context, workers int,
+	tracer Tracer) []error {
+
+	ctx, span := tracer.Start(ctx, "RunMany")
+	defer span.End()
+	span.SetAttribute("cmd.commands", len(cmds))
+
+	traced := make(Commands, len(cmds))
+	for i, c := range cmds {
+		traced[i] = &tracingCommander{cmd: c, tracer: tracer}
+	}
+	errs := traced.RunManyContext(ctx, workers)
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	span.SetAttribute("cmd.failed", failed)
+	if failed > 0 {
+		span.SetError(fmt.Errorf("%d of %d commands failed",
+			failed, len(cmds)))
+	}
+	return errs
+}
+
+// tracingCommander runs a command within a span created by "tracer".
+type tracingCommander struct {
+	cmd    Commander
+	tracer Tracer
+}
+
+func (c *tracingCommander) Run() error {
+	return c.RunContext(context.Background())
+}
+
+func (c *tracingCommander) RunContext(ctx context.Context) error {
+	var ecmd *exec.Cmd
+	name, desc := fmt.Sprintf("%T", c.cmd), fmt.Sprintf("%T", c.cmd)
+	switch cmd := c.cmd.(type) {
+	case *Command:
+		ecmd, desc = cmd.Cmd, cmd.String()
+	case *exec.Cmd:
+		ecmd, desc = cmd, cmd.String()
+	}
+	if ecmd != nil && len(ecmd.Args) > 0 {
+		name = ecmd.Args[0]
+	}
+
+	ctx, span := c.tracer.Start(ctx, name)
+	defer span.End()
+	span.SetAttribute("cmd.command", desc)
+
+	start := time.Now()
+	err := runContext(ctx, c.cmd)
+	span.SetAttribute("cmd.duration_ms", time.Since(start).Milliseconds())
+	if ecmd != nil && ecmd.ProcessState != nil {
+		span.SetAttribute("cmd.exit_code", ecmd.ProcessState.ExitCode())
+	}
+	if err != nil {
+		span.SetError(err)
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"io"
+	"os"
+)
+
+// tty is a pseudo-terminal attached to a command by WithTTY. Everything the
+// command writes to the terminal is copied from "master" to "out". "detach"
+// closes the slave end and restores the command's streams.
+type tty struct {
+	master *os.File
+	detach func()
+	copied chan struct{}
+}
+
+func newTTY(master *os.File, detach func(), out io.Writer) *tty {
+	t := &tty{master: master, detach: detach, copied: make(chan struct{})}
+	go func() {
+		defer close(t.copied)
+
+		// Once the command exits and every copy of the slave end is closed,
+		// reading from the master end fails (with EIO on Linux), which is
+		// the end of the output.
+		io.Copy(out, master)
+	}()
+	return t
+}
+
+// started closes the slave end in the current process, now that the command
+// has its own copy.
+func (t *tty) started() {
+	t.detach()
+}
+
+// abort closes both ends, when the command couldn't be started.
+func (t *tty) abort() {
+	t.detach()
+	t.master.Close()
+	<-t.copied
+}
+
+// finish waits for all of the command's output to be copied, and then
+// closes the master end.
+func (t *tty) finish() {
+	<-t.copied
+	t.master.Close()
+}
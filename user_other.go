@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cmd
+
+// WithUserAndGroup is not supported on this platform. Start (and therefore
+// Run) returns ErrUnsupported.
+func (cmd *Command) WithUserAndGroup(uid, gid uint32) *Command {
+	cmd.configErr = ErrUnsupported
+	return cmd
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package cmd
+
+import "syscall"
+
+// WithUserAndGroup configures the command to run as the user with id "uid"
+// and the group with id "gid". The current process must have permission to
+// switch to them, which usually means running as root. It must be called
+// before the command is started.
+//
+// Running as another user is not supported on Windows, where Start (and
+// therefore Run) returns ErrUnsupported.
+func (cmd *Command) WithUserAndGroup(uid, gid uint32) *Command {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid}
+	return cmd
+}
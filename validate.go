@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Validate checks that the command's executable exists and is executable,
+// and that its working directory (if set) exists and is a directory. The
+// command is not run.
+//
+// This is useful for catching configuration errors before running a large
+// batch of commands, since os/exec doesn't report them until the command is
+// started.
+func (cmd *Command) Validate() error {
+	if cmd.Dir != "" {
+		info, err := os.Stat(cmd.Dir)
+		if err != nil {
+			return fmt.Errorf("Error validating %s: %w.", cmd.describe(), err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("Error validating %s: %s is not a directory.",
+				cmd.describe(), cmd.Dir)
+		}
+	}
+
+	if _, err := exec.LookPath(cmd.executable()); err != nil {
+		return fmt.Errorf("Error validating %s: %w.", cmd.describe(), err)
+	}
+	return nil
+}
+
+// executable returns the path to the command's executable. A relative path
+// is resolved relative to Dir, just like os/exec does when the command is
+// started.
+func (cmd *Command) executable() string {
+	path := cmd.Path
+	if cmd.Dir != "" && !filepath.IsAbs(path) &&
+		strings.ContainsRune(path, os.PathSeparator) {
+		path = filepath.Join(cmd.Dir, path)
+	}
+	return path
+}
+
+// ValidateAll calls Validate on every *Command in the list, and returns the
+// errors of those that are invalid keyed by their index. Commands that
+// aren't a *Command are skipped. An empty map means that every command is
+// valid.
+func (cmds Commands) ValidateAll() map[int]error {
+	errs := make(map[int]error)
+	for i, c := range cmds {
+		if cmd, ok := c.(*Command); ok {
+			if err := cmd.Validate(); err != nil {
+				errs[i] = err
+			}
+		}
+	}
+	return errs
+}
+
+// Preflight checks that the executable of every *Command in the list exists
+// and is executable, without running anything. It returns a list of errors
+// aligned with the list of commands, where the error of a command is nil if
+// its executable was found (or if it isn't a *Command). This lets callers
+// fail early, before running any of a large batch of commands, when a
+// required program is missing.
+//
+// Unlike ValidateAll, working directories aren't checked.
+func (cmds Commands) Preflight() []error {
+	errs := make([]error, len(cmds))
+	found := make(map[string]error)
+	for i, c := range cmds {
+		cmd, ok := c.(*Command)
+		if !ok {
+			continue
+		}
+		path := cmd.executable()
+		err, ok := found[path]
+		if !ok {
+			_, err = exec.LookPath(path)
+			found[path] = err
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("Error finding the executable of %s: %w.",
+				cmd.describe(), err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+)
+
+// WithWorkDir sets the working directory of the command to "dir".
+func (cmd *Command) WithWorkDir(dir string) *Command {
+	cmd.Dir = dir
+	return cmd
+}
+
+// WithNewWorkDir is like WithWorkDir, except "dir" and any missing parents
+// are created with the permissions "perm" (before umask) if they don't
+// already exist, as with os.MkdirAll.
+func (cmd *Command) WithNewWorkDir(dir string,
+	perm os.FileMode) (*Command, error) {
+
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return nil, fmt.Errorf("Error creating working directory: %w.", err)
+	}
+	return cmd.WithWorkDir(dir), nil
+}